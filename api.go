@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/trustpilot/beat-exporter/internal/config"
+	"github.com/trustpilot/beat-exporter/internal/discovery"
+)
+
+// adminTarget is the request body of POST /api/v1/targets.
+type adminTarget struct {
+	URI    string            `json:"uri"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// adminTokenHeader carries the admin token when the Authorization header is
+// already taken by the basic authentication of the web config file.
+const adminTokenHeader = "X-Admin-Token"
+
+// requireToken rejects requests without the given bearer token, sent either
+// in the Authorization header or in the X-Admin-Token header.
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given := r.Header.Get(adminTokenHeader)
+		if given == "" {
+			given = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiHeaders marks the responses of the targets API, /targets/metrics and
+// /probe as not cacheable, and allows the given origins, or any origin with
+// "*", to call them from browsers.
+func apiHeaders(origins []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+
+		origin := r.Header.Get("Origin")
+		if origin == "" || len(origins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		for _, allowed := range origins {
+			if allowed == "*" || allowed == origin {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				break
+			}
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, "+adminTokenHeader)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// targetsAPIHandler serves the status of every target on GET and passes
+// other requests on to the admin handler, if the admin API is enabled.
+func targetsAPIHandler(targets *targetManager, admin http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			response := struct {
+				Targets []targetStatus `json:"targets"`
+			}{targets.Status()}
+			if err := json.NewEncoder(w).Encode(response); err != nil {
+				log.Errorf("Failed to write target status: %v", err)
+			}
+			return
+		}
+		if admin == nil {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		admin.ServeHTTP(w, r)
+	}
+}
+
+// adminTargetsHandler adds targets with POST and removes them with DELETE,
+// given the target URI in the uri query parameter.
+func adminTargetsHandler(api *discovery.APIDiscoverer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			var target adminTarget
+			decoder := json.NewDecoder(r.Body)
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&target); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid target: %v", err), http.StatusBadRequest)
+				return
+			}
+			tc := config.TargetConfig{URI: target.URI, Labels: target.Labels}
+			if err := tc.Validate(); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid target: %v", err), http.StatusBadRequest)
+				return
+			}
+			if err := api.Add(target.URI, target.Labels); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to add target: %v", err), http.StatusInternalServerError)
+				return
+			}
+			log.Infof("Target %s added through the admin API", target.URI)
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			uri := r.URL.Query().Get("uri")
+			found, err := api.Remove(uri)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to remove target: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, "Target not found", http.StatusNotFound)
+				return
+			}
+			log.Infof("Target %s removed through the admin API", uri)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/trustpilot/beat-exporter/internal/config"
+	"golang.org/x/net/http2"
+)
+
+// transportOptions holds the connection pooling settings of the transports
+// talking to Beats.
+type transportOptions struct {
+	maxIdleConnsPerHost int
+	idleConnTimeout     time.Duration
+	disableKeepAlives   bool
+}
+
+// newHTTPClient builds the HTTP client used to talk to a single Beat target
+// and returns it together with the URL the Beat API is reachable at. Every
+// target owns its client and transport, so that Unix socket and TCP targets
+// with different TLS and authentication settings can be mixed freely.
+func newHTTPClient(target config.TargetConfig, options transportOptions) (*http.Client, *url.URL, error) {
+	beatURL, err := config.ParseURI(target.URI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse beat URI: %w", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = options.maxIdleConnsPerHost
+	transport.IdleConnTimeout = options.idleConnTimeout
+	transport.DisableKeepAlives = options.disableKeepAlives
+
+	// Adjust transport for Unix socket and Windows named pipe
+	switch beatURL.Scheme {
+	case "unix":
+		unixPath := beatURL.Path
+		beatURL.Scheme = "http"
+		beatURL.Host = "localhost"
+		beatURL.Path = ""
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", unixPath)
+		}
+	case "npipe":
+		pipePath := config.PipePath(beatURL)
+		beatURL.Scheme = "http"
+		beatURL.Host = "localhost"
+		beatURL.Path = ""
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialPipe(ctx, pipePath)
+		}
+	}
+
+	// Without proxy_url, the transport uses the proxy of the HTTP_PROXY,
+	// HTTPS_PROXY and NO_PROXY environment variables.
+	if target.ProxyURL != "" {
+		proxyURL, err := url.Parse(target.ProxyURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if target.TLSConfig != (config.TLSConfig{}) {
+		tlsConfig, err := newTLSConfig(target.TLSConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	var roundTripper http.RoundTripper = transport
+	switch target.Protocol {
+	case config.ProtocolHTTP1:
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	case config.ProtocolH2C:
+		// Dial cleartext connections where the HTTP/2 transport expects TLS,
+		// through the dialer of the transport for sockets and pipes. DialTLS
+		// gets no context, so the dial is bounded by the timeout of the
+		// target instead of the request.
+		roundTripper = &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				ctx := context.Background()
+				if target.Timeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, target.Timeout)
+					defer cancel()
+				}
+				return transport.DialContext(ctx, network, addr)
+			},
+		}
+	}
+	if target.BasicAuth != nil {
+		roundTripper = &basicAuthRoundTripper{
+			username: target.BasicAuth.Username,
+			password: target.BasicAuth.Password,
+			next:     roundTripper,
+		}
+	}
+
+	if len(target.Headers.Headers) > 0 {
+		roundTripper = &headersRoundTripper{headers: target.Headers.Headers, next: roundTripper}
+	}
+
+	return &http.Client{Timeout: target.Timeout, Transport: roundTripper}, beatURL, nil
+}
+
+// newTLSConfig builds the client TLS configuration for a Beat target.
+func newTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		caCert, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		// Read the key pair on every handshake so rotated certificates are
+		// used without rediscovering the target.
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := cfg.LoadKeyPair()
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			return &cert, nil
+		}
+	}
+	return tlsConfig, nil
+}
+
+// basicAuthRoundTripper adds HTTP basic authentication to every request.
+type basicAuthRoundTripper struct {
+	username string
+	password string
+	next     http.RoundTripper
+}
+
+func (rt *basicAuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(rt.username, rt.password)
+	return rt.next.RoundTrip(req)
+}
+
+func (rt *basicAuthRoundTripper) CloseIdleConnections() {
+	closeIdleConnections(rt.next)
+}
+
+// headersRoundTripper adds static headers to every request.
+type headersRoundTripper struct {
+	headers map[string]string
+	next    http.RoundTripper
+}
+
+func (rt *headersRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, value := range rt.headers {
+		req.Header.Set(name, value)
+	}
+	return rt.next.RoundTrip(req)
+}
+
+func (rt *headersRoundTripper) CloseIdleConnections() {
+	closeIdleConnections(rt.next)
+}
+
+// closeIdleConnections closes the idle connections of rt, if it keeps any,
+// like http.Client.CloseIdleConnections does for its transport.
+func closeIdleConnections(rt http.RoundTripper) {
+	if closer, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/trustpilot/beat-exporter/internal/config"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// fakeBeat serves the info endpoint of a Beat of the given type and the
+// stats of testdata/filebeat-stats.json.
+func fakeBeat(t *testing.T, beat string) http.Handler {
+	t.Helper()
+	stats, err := ioutil.ReadFile(filepath.Join("testdata", "filebeat-stats.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/":
+			w.Write([]byte(`{"beat":"` + beat + `","hostname":"h1","name":"n1","uuid":"u1","version":"8.12.0","ephemeral_id":"e1"}`))
+		case strings.HasPrefix(r.URL.Path, "/stats"):
+			w.Write(stats)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// newUnixServer serves handler on a Unix socket in a temporary directory and
+// returns the URI of the socket.
+func newUnixServer(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "beat.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: handler}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return "unix://" + path
+}
+
+// gaugeValues returns the values of the metric family with the given name
+// by their target label.
+func gaugeValues(families []*dto.MetricFamily, name string) map[string]float64 {
+	values := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == config.TargetLabel {
+					values[label.GetValue()] = metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	return values
+}
+
+func TestSyncMixedSchemes(t *testing.T) {
+	tcp := httptest.NewServer(fakeBeat(t, "filebeat"))
+	defer tcp.Close()
+	unix := newUnixServer(t, fakeBeat(t, "filebeat"))
+
+	targets := newTargetManager(prometheus.NewRegistry(), scrapeOptions{}, 0, 0, 0, 0)
+	if failed := targets.Sync([]config.TargetConfig{{URI: tcp.URL}, {URI: unix}}); len(failed) > 0 {
+		t.Fatalf("failed to discover %v", failed)
+	}
+	defer func() {
+		for _, target := range targets.targets {
+			target.close()
+		}
+	}()
+
+	tcpTarget, unixTarget := targets.targets[tcp.URL], targets.targets[unix]
+	if tcpTarget == nil || unixTarget == nil {
+		t.Fatalf("targets = %v, want %s and %s", targets.targets, tcp.URL, unix)
+	}
+	if tcpTarget.client == unixTarget.client || tcpTarget.client.Transport == unixTarget.client.Transport {
+		t.Error("targets share their HTTP client or transport")
+	}
+
+	families, err := targets.Gather()
+	if err != nil {
+		t.Fatalf("gather failed: %v", err)
+	}
+	up := gaugeValues(families, "filebeat_up")
+	for _, uri := range []string{tcp.URL, unix} {
+		if up[uri] != 1 {
+			t.Errorf("filebeat_up{target=%q} = %v, want 1", uri, up[uri])
+		}
+	}
+}
+
+func TestSyncIPv6Literal(t *testing.T) {
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	server := &http.Server{Handler: fakeBeat(t, "filebeat")}
+	go server.Serve(listener)
+	defer server.Close()
+
+	uri := "http://" + listener.Addr().String()
+	targets := newTargetManager(prometheus.NewRegistry(), scrapeOptions{}, 0, 0, 0, 0)
+	if failed := targets.Sync([]config.TargetConfig{{URI: uri}}); len(failed) > 0 {
+		t.Fatalf("failed to discover %v", failed)
+	}
+	defer targets.targets[uri].close()
+
+	families, err := targets.Gather()
+	if err != nil {
+		t.Fatalf("gather failed: %v", err)
+	}
+	if up := gaugeValues(families, "filebeat_up"); up[uri] != 1 {
+		t.Errorf("filebeat_up{target=%q} = %v, want 1", uri, up[uri])
+	}
+}
+
+// TestH2CUnixSocket checks that protocol h2c speaks HTTP/2 without TLS
+// through the dialer of a Unix socket target with a timeout.
+func TestH2CUnixSocket(t *testing.T) {
+	var proto string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto = r.Proto
+		w.Write([]byte(`{}`))
+	})
+	uri := newUnixServer(t, h2c.NewHandler(handler, &http2.Server{}))
+
+	client, beatURL, err := newHTTPClient(config.TargetConfig{URI: uri, Protocol: config.ProtocolH2C, Timeout: 5 * time.Second}, transportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Get(beatURL.String() + "/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if proto != "HTTP/2.0" {
+		t.Errorf("request protocol = %s, want HTTP/2.0", proto)
+	}
+}
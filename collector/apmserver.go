@@ -0,0 +1,338 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// APMServerDecoder json structure of the stats of one request body encoding
+type APMServerDecoder struct {
+	ContentLength float64 `json:"content-length"`
+	Count         float64 `json:"count"`
+}
+
+// APMServer json structure
+type APMServer struct {
+	Server struct {
+		Request struct {
+			Count float64 `json:"count"`
+		} `json:"request"`
+		Response struct {
+			Count float64 `json:"count"`
+			Valid struct {
+				Count       float64 `json:"count"`
+				Accepted    float64 `json:"accepted"`
+				OK          float64 `json:"ok"`
+				NotModified float64 `json:"notmodified"`
+			} `json:"valid"`
+			Errors struct {
+				Count        float64 `json:"count"`
+				TooLarge     float64 `json:"toolarge"`
+				Validate     float64 `json:"validate"`
+				RateLimit    float64 `json:"ratelimit"`
+				Queue        float64 `json:"queue"`
+				Closed       float64 `json:"closed"`
+				Forbidden    float64 `json:"forbidden"`
+				Concurrency  float64 `json:"concurrency"`
+				Unauthorized float64 `json:"unauthorized"`
+				Internal     float64 `json:"internal"`
+				Decode       float64 `json:"decode"`
+				Method       float64 `json:"method"`
+				Timeout      float64 `json:"timeout"`
+				NotFound     float64 `json:"notfound"`
+				InvalidQuery float64 `json:"invalidquery"`
+			} `json:"errors"`
+		} `json:"response"`
+	} `json:"server"`
+	Decoder struct {
+		Deflate      APMServerDecoder `json:"deflate"`
+		Gzip         APMServerDecoder `json:"gzip"`
+		Uncompressed APMServerDecoder `json:"uncompressed"`
+		Reader       struct {
+			Count float64 `json:"count"`
+		} `json:"reader"`
+		MissingContentLength struct {
+			Count float64 `json:"count"`
+		} `json:"missing-content-length"`
+	} `json:"decoder"`
+	Sampling struct {
+		TransactionsDropped float64 `json:"transactions_dropped"`
+	} `json:"sampling"`
+}
+
+type apmServerCollector struct {
+	beatInfo *BeatInfo
+	stats    *Stats
+	metrics  exportedMetrics
+}
+
+// NewAPMServerCollector constructor
+func NewAPMServerCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
+	return &apmServerCollector{
+		beatInfo: beatInfo,
+		stats:    stats,
+		metrics: exportedMetrics{
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "requests_total"),
+					"apm-server.server.request.count",
+					nil, nil,
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Request.Count },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "responses_total"),
+					"apm-server.server.response.count",
+					nil, nil,
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Response.Count },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "responses_valid_total"),
+					"apm-server.server.response.valid",
+					nil, prometheus.Labels{"status": "accepted"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Response.Valid.Accepted },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "responses_valid_total"),
+					"apm-server.server.response.valid",
+					nil, prometheus.Labels{"status": "ok"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Response.Valid.OK },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "responses_valid_total"),
+					"apm-server.server.response.valid",
+					nil, prometheus.Labels{"status": "notmodified"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Response.Valid.NotModified },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "responses_errors_total"),
+					"apm-server.server.response.errors",
+					nil, prometheus.Labels{"reason": "toolarge"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Response.Errors.TooLarge },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "responses_errors_total"),
+					"apm-server.server.response.errors",
+					nil, prometheus.Labels{"reason": "validate"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Response.Errors.Validate },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "responses_errors_total"),
+					"apm-server.server.response.errors",
+					nil, prometheus.Labels{"reason": "ratelimit"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Response.Errors.RateLimit },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "responses_errors_total"),
+					"apm-server.server.response.errors",
+					nil, prometheus.Labels{"reason": "queue"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Response.Errors.Queue },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "responses_errors_total"),
+					"apm-server.server.response.errors",
+					nil, prometheus.Labels{"reason": "closed"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Response.Errors.Closed },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "responses_errors_total"),
+					"apm-server.server.response.errors",
+					nil, prometheus.Labels{"reason": "forbidden"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Response.Errors.Forbidden },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "responses_errors_total"),
+					"apm-server.server.response.errors",
+					nil, prometheus.Labels{"reason": "concurrency"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Response.Errors.Concurrency },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "responses_errors_total"),
+					"apm-server.server.response.errors",
+					nil, prometheus.Labels{"reason": "unauthorized"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Response.Errors.Unauthorized },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "responses_errors_total"),
+					"apm-server.server.response.errors",
+					nil, prometheus.Labels{"reason": "internal"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Response.Errors.Internal },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "responses_errors_total"),
+					"apm-server.server.response.errors",
+					nil, prometheus.Labels{"reason": "decode"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Response.Errors.Decode },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "responses_errors_total"),
+					"apm-server.server.response.errors",
+					nil, prometheus.Labels{"reason": "method"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Response.Errors.Method },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "responses_errors_total"),
+					"apm-server.server.response.errors",
+					nil, prometheus.Labels{"reason": "timeout"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Response.Errors.Timeout },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "responses_errors_total"),
+					"apm-server.server.response.errors",
+					nil, prometheus.Labels{"reason": "notfound"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Response.Errors.NotFound },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "server", "responses_errors_total"),
+					"apm-server.server.response.errors",
+					nil, prometheus.Labels{"reason": "invalidquery"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Server.Response.Errors.InvalidQuery },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "decoder", "requests_total"),
+					"apm-server.decoder.count",
+					nil, prometheus.Labels{"encoding": "deflate"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Decoder.Deflate.Count },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "decoder", "requests_total"),
+					"apm-server.decoder.count",
+					nil, prometheus.Labels{"encoding": "gzip"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Decoder.Gzip.Count },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "decoder", "requests_total"),
+					"apm-server.decoder.count",
+					nil, prometheus.Labels{"encoding": "uncompressed"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Decoder.Uncompressed.Count },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "decoder", "content_length_bytes_total"),
+					"apm-server.decoder.content-length",
+					nil, prometheus.Labels{"encoding": "deflate"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Decoder.Deflate.ContentLength },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "decoder", "content_length_bytes_total"),
+					"apm-server.decoder.content-length",
+					nil, prometheus.Labels{"encoding": "gzip"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Decoder.Gzip.ContentLength },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "decoder", "content_length_bytes_total"),
+					"apm-server.decoder.content-length",
+					nil, prometheus.Labels{"encoding": "uncompressed"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Decoder.Uncompressed.ContentLength },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "decoder", "reader_total"),
+					"apm-server.decoder.reader.count",
+					nil, nil,
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Decoder.Reader.Count },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "decoder", "missing_content_length_total"),
+					"apm-server.decoder.missing-content-length.count",
+					nil, nil,
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Decoder.MissingContentLength.Count },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "sampling", "transactions_dropped_total"),
+					"apm-server.sampling.transactions_dropped",
+					nil, nil,
+				),
+				eval:    func(stats *Stats) float64 { return stats.APMServer.Sampling.TransactionsDropped },
+				valType: prometheus.CounterValue,
+			},
+		},
+	}
+}
+
+// Describe returns all descriptions of the collector.
+func (c *apmServerCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.metrics.describe(ch)
+}
+
+// Collect returns the current state of all metrics of the collector.
+func (c *apmServerCollector) Collect(ch chan<- prometheus.Metric) {
+	c.metrics.collect(ch, c.stats)
+}
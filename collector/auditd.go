@@ -26,47 +26,47 @@ func NewAuditdCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
 		metrics: exportedMetrics{
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "auditd", "kernel_lost"),
+					prometheus.BuildFQName(beatInfo.namespace(), "auditd", "kernel_lost"),
 					"auditd.kernel_lost",
 					nil, nil,
 				),
 				eval: func(stats *Stats) float64 {
 					return stats.Auditd.KernelLost
 				},
-				valType: prometheus.GaugeValue,
+				valType: beatInfo.cumulativeValueType(),
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "auditd", "reassembler_seq_gaps"),
+					prometheus.BuildFQName(beatInfo.namespace(), "auditd", "reassembler_seq_gaps"),
 					"auditd.reassembler_seq_gaps",
 					nil, nil,
 				),
 				eval: func(stats *Stats) float64 {
 					return stats.Auditd.ReassemblerSeqGaps
 				},
-				valType: prometheus.GaugeValue,
+				valType: beatInfo.cumulativeValueType(),
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "auditd", "received_msgs"),
+					prometheus.BuildFQName(beatInfo.namespace(), "auditd", "received_msgs"),
 					"auditd.received_msgs",
 					nil, nil,
 				),
 				eval: func(stats *Stats) float64 {
 					return stats.Auditd.ReceivedMsgs
 				},
-				valType: prometheus.GaugeValue,
+				valType: beatInfo.cumulativeValueType(),
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "auditd", "userspace_lost"),
+					prometheus.BuildFQName(beatInfo.namespace(), "auditd", "userspace_lost"),
 					"auditd.userspace_lost",
 					nil, nil,
 				),
 				eval: func(stats *Stats) float64 {
 					return stats.Auditd.UserspaceLost
 				},
-				valType: prometheus.GaugeValue,
+				valType: beatInfo.cumulativeValueType(),
 			},
 		},
 	}
@@ -75,17 +75,13 @@ func NewAuditdCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
 // Describe returns all descriptions of the collector.
 func (c *auditdCollector) Describe(ch chan<- *prometheus.Desc) {
 
-	for _, metric := range c.metrics {
-		ch <- metric.desc
-	}
+	c.metrics.describe(ch)
 
 }
 
 // Collect returns the current state of all metrics of the collector.
 func (c *auditdCollector) Collect(ch chan<- prometheus.Metric) {
 
-	for _, i := range c.metrics {
-		ch <- prometheus.MustNewConstMetric(i.desc, i.valType, i.eval(c.stats))
-	}
+	c.metrics.collect(ch, c.stats)
 
 }
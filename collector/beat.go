@@ -56,7 +56,7 @@ func NewBeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
 		metrics: exportedMetrics{
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "cpu_time", "seconds_total"),
+					prometheus.BuildFQName(beatInfo.namespace(), "cpu_time", "seconds_total"),
 					"beat.cpu.time",
 					nil, prometheus.Labels{"mode": "system"},
 				),
@@ -67,7 +67,7 @@ func NewBeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "cpu_time", "seconds_total"),
+					prometheus.BuildFQName(beatInfo.namespace(), "cpu_time", "seconds_total"),
 					"beat.cpu.time",
 					nil, prometheus.Labels{"mode": "user"},
 				),
@@ -78,7 +78,7 @@ func NewBeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "cpu", "ticks_total"),
+					prometheus.BuildFQName(beatInfo.namespace(), "cpu", "ticks_total"),
 					"beat.cpu.ticks",
 					nil, prometheus.Labels{"mode": "system"},
 				),
@@ -87,7 +87,7 @@ func NewBeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "cpu", "ticks_total"),
+					prometheus.BuildFQName(beatInfo.namespace(), "cpu", "ticks_total"),
 					"beat.cpu.ticks",
 					nil, prometheus.Labels{"mode": "user"},
 				),
@@ -96,7 +96,7 @@ func NewBeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "uptime", "seconds_total"),
+					prometheus.BuildFQName(beatInfo.namespace(), "uptime", "seconds_total"),
 					"beat.info.uptime.ms",
 					nil, nil,
 				),
@@ -107,7 +107,7 @@ func NewBeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "memstats", "gc_next_total"),
+					prometheus.BuildFQName(beatInfo.namespace(), "memstats", "gc_next_total"),
 					"beat.memstats.gc_next",
 					nil, nil,
 				),
@@ -118,7 +118,7 @@ func NewBeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "memstats", "memory_alloc"),
+					prometheus.BuildFQName(beatInfo.namespace(), "memstats", "memory_alloc"),
 					"beat.memstats.memory_alloc",
 					nil, nil,
 				),
@@ -129,7 +129,7 @@ func NewBeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "memstats", "memory"),
+					prometheus.BuildFQName(beatInfo.namespace(), "memstats", "memory"),
 					"beat.memstats.memory_total",
 					nil, nil,
 				),
@@ -140,7 +140,7 @@ func NewBeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "memstats", "rss"),
+					prometheus.BuildFQName(beatInfo.namespace(), "memstats", "rss"),
 					"beat.memstats.rss",
 					nil, nil,
 				),
@@ -151,7 +151,7 @@ func NewBeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "runtime", "goroutines"),
+					prometheus.BuildFQName(beatInfo.namespace(), "runtime", "goroutines"),
 					"beat.runtime.goroutines",
 					nil, nil,
 				),
@@ -167,17 +167,13 @@ func NewBeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
 // Describe returns all descriptions of the collector.
 func (c *beatCollector) Describe(ch chan<- *prometheus.Desc) {
 
-	for _, metric := range c.metrics {
-		ch <- metric.desc
-	}
+	c.metrics.describe(ch)
 
 }
 
 // Collect returns the current state of all metrics of the collector.
 func (c *beatCollector) Collect(ch chan<- prometheus.Metric) {
 
-	for _, i := range c.metrics {
-		ch <- prometheus.MustNewConstMetric(i.desc, i.valType, i.eval(c.stats))
-	}
+	c.metrics.collect(ch, c.stats)
 
 }
@@ -0,0 +1,84 @@
+package collector
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// DatasetField is a numeric field of a dataset listed by the /dataset
+// endpoint of a Beat.
+type DatasetField struct {
+	// Dataset is the key of the dataset, e.g. the ID of a Filebeat input.
+	Dataset string
+	// Input is the type of the input reading the dataset, if it has one.
+	Input string
+	// Path is the dotted path of the field within the dataset.
+	Path  string
+	Value float64
+}
+
+type datasetCollector struct {
+	beatInfo *BeatInfo
+	stats    *Stats
+}
+
+// NewDatasetCollector constructor
+func NewDatasetCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
+	return &datasetCollector{
+		beatInfo: beatInfo,
+		stats:    stats,
+	}
+}
+
+// Describe returns all descriptions of the collector. The metrics depend on
+// the fields of the datasets, so none are described upfront.
+func (c *datasetCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+// Collect returns the current state of all metrics of the collector.
+func (c *datasetCollector) Collect(ch chan<- prometheus.Metric) {
+
+	seen := make(map[string]bool, len(c.stats.Datasets))
+	for _, field := range c.stats.Datasets {
+		fieldName := unknownFieldName("", field.Path)
+		name := prometheus.BuildFQName(c.beatInfo.namespace(), "dataset", fieldName)
+		key := field.Dataset + "\x00" + name
+		if seen[key] {
+			log.Debugf("Skipping field %s of dataset %s, named %s like another field", field.Path, field.Dataset, name)
+			continue
+		}
+		seen[key] = true
+		// The help must be the same for the fields of every dataset
+		// getting this name, so it names the field by the metric name.
+		desc := prometheus.NewDesc(name, "Field "+fieldName+" of the datasets of the Beat", []string{"dataset", "input_type"}, nil)
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.UntypedValue, field.Value, field.Dataset, field.Input)
+	}
+
+}
+
+// datasetFields returns the numeric fields of the datasets listed by the
+// /dataset endpoint, sorted by dataset and path.
+func datasetFields(datasets map[string]interface{}) []DatasetField {
+	var fields []DatasetField
+	for dataset, value := range datasets {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		input, _ := object["input"].(string)
+		var leaves []unknownField
+		flattenFields(object, "", &leaves)
+		for _, leaf := range leaves {
+			fields = append(fields, DatasetField{Dataset: dataset, Input: input, Path: leaf.path, Value: leaf.value})
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].Dataset != fields[j].Dataset {
+			return fields[i].Dataset < fields[j].Dataset
+		}
+		return fields[i].Path < fields[j].Path
+	})
+	return fields
+}
@@ -0,0 +1,90 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestDatasetFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		datasets map[string]interface{}
+		want     []DatasetField
+	}{
+		{
+			name: "nested fields",
+			datasets: map[string]interface{}{
+				"logs-b": map[string]interface{}{
+					"input":  "filestream",
+					"events": map[string]interface{}{"total": 3.0, "dropped": 1.0},
+				},
+				"logs-a": map[string]interface{}{
+					"bytes": 10.0,
+				},
+			},
+			want: []DatasetField{
+				{Dataset: "logs-a", Path: "bytes", Value: 10},
+				{Dataset: "logs-b", Input: "filestream", Path: "events.dropped", Value: 1},
+				{Dataset: "logs-b", Input: "filestream", Path: "events.total", Value: 3},
+			},
+		},
+		{
+			name: "fields that aren't numbers",
+			datasets: map[string]interface{}{
+				"logs": map[string]interface{}{
+					"name":    "access",
+					"enabled": true,
+					"paths":   []interface{}{1.0},
+					"events":  map[string]interface{}{},
+				},
+			},
+		},
+		{
+			name:     "datasets that aren't objects",
+			datasets: map[string]interface{}{"logs": 1.0, "other": "x"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := datasetFields(test.datasets); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("fields = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestFetchDatasets checks the series of a /dataset response, whose fields
+// events.total and events_total get the same name: the first by path is
+// kept within a dataset, and both are exported across datasets.
+func TestFetchDatasets(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dataset" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"logs-a":{"input":"filestream","events":{"total":3},"events_total":4},"logs-b":{"bytes":10,"events_total":5}}`))
+	}))
+	defer server.Close()
+	beatURL, _ := url.Parse(server.URL)
+
+	beatInfo := &BeatInfo{Beat: "filebeat", Version: "8.12.0"}
+	b := &mainCollector{client: server.Client(), beatURL: beatURL, Stats: &Stats{}}
+	if err := b.fetchDatasets(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	compareGolden(t, NewDatasetCollector(beatInfo, b.Stats), "dataset")
+
+	status = http.StatusInternalServerError
+	if err := b.fetchDatasets(context.Background()); err == nil {
+		t.Error("fetched datasets from a failing endpoint without error")
+	}
+	if b.Stats.Datasets != nil {
+		t.Errorf("datasets = %+v after a failed request, want none", b.Stats.Datasets)
+	}
+}
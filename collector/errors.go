@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// Reasons a scrape of a Beat failed, as exported in the reason label of
+// beat_exporter_scrape_errors_total.
+const (
+	reasonTimeout           = "timeout"
+	reasonConnectionRefused = "connection_refused"
+	reasonHTTPStatus        = "http_status"
+	reasonResponseTooLarge  = "response_too_large"
+	reasonDecode            = "decode"
+	reasonRegistry          = "registry"
+	reasonOther             = "other"
+)
+
+var scrapeErrorReasons = []string{
+	reasonTimeout,
+	reasonConnectionRefused,
+	reasonHTTPStatus,
+	reasonResponseTooLarge,
+	reasonDecode,
+	reasonRegistry,
+	reasonOther,
+}
+
+// statusError is returned for responses of the Beat with a status other than 200.
+type statusError struct {
+	code int
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("received non-200 response: %d", e.code)
+}
+
+// decodeError is returned for responses of the Beat that aren't valid JSON.
+type decodeError struct {
+	err error
+}
+
+func (e decodeError) Error() string {
+	return fmt.Sprintf("failed to decode response: %v", e.err)
+}
+
+func (e decodeError) Unwrap() error {
+	return e.err
+}
+
+// scrapeErrorReason classifies the error of a failed scrape.
+func scrapeErrorReason(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrResponseTooLarge):
+		return reasonResponseTooLarge
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return reasonTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return reasonConnectionRefused
+	case errors.As(err, new(statusError)):
+		return reasonHTTPStatus
+	case errors.As(err, new(decodeError)):
+		return reasonDecode
+	default:
+		return reasonOther
+	}
+}
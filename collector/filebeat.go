@@ -1,7 +1,9 @@
 package collector
 
 import (
-	"log"
+	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -29,6 +31,7 @@ type Filebeat struct {
 				Truncated float64 `json:"truncated"`
 			} `json:"files"`
 		} `json:"log"`
+		Journald Journald `json:"journald"`
 	} `json:"input"`
 }
 
@@ -36,77 +39,136 @@ type Filebeat struct {
 type filebeatCollector struct {
 	beatInfo *BeatInfo
 	stats    *Stats
-	metrics  map[string]*prometheus.Desc
+	metrics  exportedMetrics
 }
 
-// NewFilebeatCollector creates a new instance of the Filebeat collector.
-func NewFilebeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
-	metrics := make(map[string]*prometheus.Desc)
-
-	// Define all the metrics we want to track, stored in a map for easier reuse.
-	metricLabels := []struct {
-		name      string
-		help      string
-		labels    prometheus.Labels
-		subsystem string
-	}{
-		{"events_active", "Number of active events", prometheus.Labels{"event": "active"}, "events"},
-		{"events_added", "Number of added events", prometheus.Labels{"event": "added"}, "events"},
-		{"events_done", "Number of completed events", prometheus.Labels{"event": "done"}, "events"},
-		{"harvester_closed", "Number of closed harvesters", prometheus.Labels{"harvester": "closed"}, "harvester"},
-		{"harvester_open_files", "Number of open files by harvesters", prometheus.Labels{"harvester": "open_files"}, "harvester"},
-		{"harvester_running", "Number of running harvesters", prometheus.Labels{"harvester": "running"}, "harvester"},
-		{"harvester_skipped", "Number of skipped harvesters", prometheus.Labels{"harvester": "skipped"}, "harvester"},
-		{"harvester_started", "Number of started harvesters", prometheus.Labels{"harvester": "started"}, "harvester"},
-		{"input_log_files_renamed", "Number of renamed log files", prometheus.Labels{"files": "renamed"}, "input_log"},
-		{"input_log_files_truncated", "Number of truncated log files", prometheus.Labels{"files": "truncated"}, "input_log"},
+// filebeatMetric describes a metric of the Filebeat collector. Its name
+// includes the subsystem, which the legacy scheme repeats and also labels.
+type filebeatMetric struct {
+	name      string
+	help      string
+	labels    prometheus.Labels
+	subsystem string
+	valType   prometheus.ValueType
+	eval      func(stats *Stats) float64
+}
+
+// filebeatMetrics returns the metrics of the Filebeat collector, whose
+// cumulative ones are typed as set by the naming of the Beat.
+func filebeatMetrics(beatInfo *BeatInfo) []filebeatMetric {
+	return []filebeatMetric{
+		{"events_active", "Number of active events", prometheus.Labels{"event": "active"}, "events", prometheus.GaugeValue,
+			func(stats *Stats) float64 { return stats.Filebeat.Events.Active }},
+		{"events_added", "Number of added events", prometheus.Labels{"event": "added"}, "events", beatInfo.cumulativeValueType(),
+			func(stats *Stats) float64 { return stats.Filebeat.Events.Added }},
+		{"events_done", "Number of completed events", prometheus.Labels{"event": "done"}, "events", beatInfo.cumulativeValueType(),
+			func(stats *Stats) float64 { return stats.Filebeat.Events.Done }},
+		{"harvester_closed", "Number of closed harvesters", prometheus.Labels{"harvester": "closed"}, "harvester", beatInfo.cumulativeValueType(),
+			func(stats *Stats) float64 { return stats.Filebeat.Harvester.Closed }},
+		{"harvester_open_files", "Number of open files by harvesters", prometheus.Labels{"harvester": "open_files"}, "harvester", prometheus.GaugeValue,
+			func(stats *Stats) float64 { return stats.Filebeat.Harvester.OpenFiles }},
+		{"harvester_running", "Number of running harvesters", prometheus.Labels{"harvester": "running"}, "harvester", prometheus.GaugeValue,
+			func(stats *Stats) float64 { return stats.Filebeat.Harvester.Running }},
+		{"harvester_skipped", "Number of skipped harvesters", prometheus.Labels{"harvester": "skipped"}, "harvester", beatInfo.cumulativeValueType(),
+			func(stats *Stats) float64 { return stats.Filebeat.Harvester.Skipped }},
+		{"harvester_started", "Number of started harvesters", prometheus.Labels{"harvester": "started"}, "harvester", beatInfo.cumulativeValueType(),
+			func(stats *Stats) float64 { return stats.Filebeat.Harvester.Started }},
+		{"input_log_files_renamed", "Number of renamed log files", prometheus.Labels{"files": "renamed"}, "input_log", beatInfo.cumulativeValueType(),
+			func(stats *Stats) float64 { return stats.Filebeat.Input.Log.Files.Renamed }},
+		{"input_log_files_truncated", "Number of truncated log files", prometheus.Labels{"files": "truncated"}, "input_log", beatInfo.cumulativeValueType(),
+			func(stats *Stats) float64 { return stats.Filebeat.Input.Log.Files.Truncated }},
 	}
+}
+
+// legacyName returns the name of the metric under the legacy scheme, e.g.
+// filebeat_events_events_active.
+func (m filebeatMetric) legacyName(beatInfo *BeatInfo) string {
+	return prometheus.BuildFQName(beatInfo.namespace(), m.subsystem, m.name)
+}
 
-	for _, label := range metricLabels {
-		metrics[label.name] = prometheus.NewDesc(
-			prometheus.BuildFQName(beatInfo.Beat, label.subsystem, label.name),
-			label.help,
-			nil, label.labels,
-		)
+// cleanName returns the name of the metric with CleanNames, e.g.
+// filebeat_events_active.
+func (m filebeatMetric) cleanName(beatInfo *BeatInfo) string {
+	return prometheus.BuildFQName(beatInfo.namespace(), "", m.name)
+}
+
+// trustpilotName returns the name of the metric in the original
+// trustpilot/beat-exporter, e.g. filebeat_filebeat_events, whose series are
+// told apart by the label alone.
+func (m filebeatMetric) trustpilotName(beatInfo *BeatInfo) string {
+	return prometheus.BuildFQName(beatInfo.namespace(), "filebeat", m.subsystem)
+}
+
+// series returns the series of the metric named name, with its labels.
+func (m filebeatMetric) series(name string) string {
+	var labels []string
+	for label, value := range m.labels {
+		labels = append(labels, fmt.Sprintf("%s=%q", label, value))
 	}
+	sort.Strings(labels)
+	return name + "{" + strings.Join(labels, ",") + "}"
+}
 
-	return &filebeatCollector{
+// Rename is a series whose name or labels change with CleanNames or
+// LegacyNames.
+type Rename struct {
+	Old, New string
+}
+
+// CleanNameRenames returns the series of the Beat that CleanNames renames,
+// without the labels and prefix added by the registerer.
+func CleanNameRenames(beatInfo *BeatInfo) []Rename {
+	var renames []Rename
+	for _, m := range filebeatMetrics(beatInfo) {
+		renames = append(renames, Rename{
+			Old: m.series(m.legacyName(beatInfo)),
+			New: m.cleanName(beatInfo),
+		})
+	}
+	return renames
+}
+
+// LegacyNameRenames returns the series of the Beat that LegacyNames exports
+// under the names of the original trustpilot/beat-exporter, from the
+// original series to those exported without LegacyNames.
+func LegacyNameRenames(beatInfo *BeatInfo) []Rename {
+	var renames []Rename
+	for _, m := range filebeatMetrics(beatInfo) {
+		renames = append(renames, Rename{
+			Old: m.series(m.trustpilotName(beatInfo)),
+			New: m.series(m.legacyName(beatInfo)),
+		})
+	}
+	return append(renames, libbeatEventRenames(beatInfo)...)
+}
+
+// NewFilebeatCollector creates a new instance of the Filebeat collector.
+func NewFilebeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
+	c := &filebeatCollector{
 		beatInfo: beatInfo,
 		stats:    stats,
-		metrics:  metrics,
 	}
+	for _, m := range filebeatMetrics(beatInfo) {
+		desc, valType := prometheus.NewDesc(m.legacyName(beatInfo), m.help, nil, m.labels), m.valType
+		switch {
+		case beatInfo.Naming.CleanNames:
+			desc = prometheus.NewDesc(m.cleanName(beatInfo), m.help, nil, nil)
+		case beatInfo.Naming.LegacyNames:
+			// The series of a subsystem share a family, of a single type.
+			desc = prometheus.NewDesc(m.trustpilotName(beatInfo), "filebeat."+m.subsystem, nil, m.labels)
+			valType = prometheus.UntypedValue
+		}
+		c.metrics = append(c.metrics, exportedMetric{desc: desc, eval: m.eval, valType: valType})
+	}
+	return c
 }
 
 // Describe sends the metrics descriptions to the Prometheus channel.
 func (c *filebeatCollector) Describe(ch chan<- *prometheus.Desc) {
-	for _, desc := range c.metrics {
-		ch <- desc
-	}
+	c.metrics.describe(ch)
 }
 
 // Collect fetches the latest metrics and sends them to the Prometheus channel.
 func (c *filebeatCollector) Collect(ch chan<- prometheus.Metric) {
-	metricValues := map[string]float64{
-		"events_active":             c.stats.Filebeat.Events.Active,
-		"events_added":              c.stats.Filebeat.Events.Added,
-		"events_done":               c.stats.Filebeat.Events.Done,
-		"harvester_closed":          c.stats.Filebeat.Harvester.Closed,
-		"harvester_open_files":      c.stats.Filebeat.Harvester.OpenFiles,
-		"harvester_running":         c.stats.Filebeat.Harvester.Running,
-		"harvester_skipped":         c.stats.Filebeat.Harvester.Skipped,
-		"harvester_started":         c.stats.Filebeat.Harvester.Started,
-		"input_log_files_renamed":   c.stats.Filebeat.Input.Log.Files.Renamed,
-		"input_log_files_truncated": c.stats.Filebeat.Input.Log.Files.Truncated,
-	}
-
-	for key, val := range metricValues {
-		if desc, ok := c.metrics[key]; ok {
-			metric, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, val)
-			if err != nil {
-				log.Printf("error creating metric %s: %v", key, err)
-				continue
-			}
-			ch <- metric
-		}
-	}
+	c.metrics.collect(ch, c.stats)
 }
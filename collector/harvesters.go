@@ -0,0 +1,333 @@
+package collector
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Harvester is the state of a file read by Filebeat, as recorded in its
+// registry.
+type Harvester struct {
+	Source string
+	Offset float64
+	// Size is the size of the file, if the exporter can stat it.
+	Size *float64
+	// Updated is when Filebeat last recorded the state of the file, zero if
+	// the registry holds no readable timestamp.
+	Updated time.Time
+}
+
+// registryEntry json structure of an entry of the registry of Filebeat,
+// written by the log input (source, offset, timestamp) or by filestream
+// (meta.source, cursor.offset, updated).
+type registryEntry struct {
+	Source    string    `json:"source"`
+	Offset    float64   `json:"offset"`
+	Timestamp []float64 `json:"timestamp"`
+	Meta      struct {
+		Source string `json:"source"`
+	} `json:"meta"`
+	Cursor struct {
+		Offset float64 `json:"offset"`
+	} `json:"cursor"`
+	Updated     []float64    `json:"updated"`
+	FileStateOS *fileStateOS `json:"FileStateOS"`
+}
+
+// fileStateOS json structure of the identity of a file on Unix, recorded by
+// the log input and in the keys of filestream with the native identifier.
+type fileStateOS struct {
+	Inode  uint64 `json:"inode"`
+	Device uint64 `json:"device"`
+}
+
+// keyFileState returns the identity of the file in a registry key ending in
+// native::<inode>-<device>, or nil.
+func keyFileState(key string) *fileStateOS {
+	i := strings.LastIndex(key, "native::")
+	if i < 0 {
+		return nil
+	}
+	parts := strings.Split(key[i+len("native::"):], "-")
+	if len(parts) != 2 {
+		return nil
+	}
+	inode, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil
+	}
+	device, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return nil
+	}
+	return &fileStateOS{Inode: inode, Device: device}
+}
+
+// readRegistry returns the state of every file in the registry of Filebeat
+// in dir, e.g. /var/lib/filebeat/registry/filebeat: the last checkpoint
+// with the operations of log.json applied. Files recorded more than once
+// keep their latest state. Harvesters are sorted by source. Files that were
+// rotated or replaced since, i.e. whose inode and device differ from the
+// registry, are of unknown size.
+func readRegistry(dir string) ([]Harvester, error) {
+	entries := map[string]json.RawMessage{}
+
+	// active.dat names the checkpoint, by a path that may only be valid
+	// where Filebeat runs, so only its base name is used.
+	if active, err := ioutil.ReadFile(filepath.Join(dir, "active.dat")); err == nil {
+		if name := strings.TrimSpace(string(active)); name != "" {
+			checkpoint, err := ioutil.ReadFile(filepath.Join(dir, filepath.Base(name)))
+			if err != nil {
+				return nil, err
+			}
+			var states []map[string]json.RawMessage
+			if err := json.Unmarshal(checkpoint, &states); err != nil {
+				return nil, fmt.Errorf("failed to decode checkpoint %s: %w", name, err)
+			}
+			for _, state := range states {
+				var key string
+				if err := json.Unmarshal(state["_key"], &key); err != nil {
+					continue
+				}
+				value, _ := json.Marshal(state)
+				entries[key] = value
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := readRegistryLog(filepath.Join(dir, "log.json"), entries); err != nil {
+		return nil, err
+	}
+
+	var harvesters []Harvester
+	for key, value := range entries {
+		var entry registryEntry
+		if err := json.Unmarshal(value, &entry); err != nil {
+			continue
+		}
+		harvester := Harvester{Source: entry.Source, Offset: entry.Offset, Updated: registryTime(entry.Timestamp)}
+		if harvester.Source == "" {
+			harvester = Harvester{Source: entry.Meta.Source, Offset: entry.Cursor.Offset, Updated: registryTime(entry.Updated)}
+		}
+		if harvester.Source == "" {
+			continue
+		}
+		state := entry.FileStateOS
+		if state == nil {
+			state = keyFileState(key)
+		}
+		if info, err := os.Stat(harvester.Source); err == nil && sameFile(info, state) {
+			size := float64(info.Size())
+			harvester.Size = &size
+		}
+		harvesters = append(harvesters, harvester)
+	}
+	sort.Slice(harvesters, func(i, j int) bool {
+		if harvesters[i].Source != harvesters[j].Source {
+			return harvesters[i].Source < harvesters[j].Source
+		}
+		return harvesters[i].Updated.After(harvesters[j].Updated)
+	})
+	unique := harvesters[:0]
+	for i, harvester := range harvesters {
+		if i == 0 || harvester.Source != harvesters[i-1].Source {
+			unique = append(unique, harvester)
+		}
+	}
+	return unique, nil
+}
+
+// readRegistryLog applies the operations of the registry log at path to
+// entries. Every operation is a line like {"op":"set","id":1} followed by
+// a line with its key and value, {"k":"...","v":{...}}.
+func readRegistryLog(path string, entries map[string]json.RawMessage) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	var op string
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		if op == "" {
+			var action struct {
+				Op string `json:"op"`
+			}
+			if err := json.Unmarshal(line, &action); err != nil {
+				return fmt.Errorf("failed to decode %s: %w", path, err)
+			}
+			op = action.Op
+			continue
+		}
+		var record struct {
+			K string          `json:"k"`
+			V json.RawMessage `json:"v"`
+		}
+		// The last line may be cut off while Filebeat writes it.
+		if err := json.Unmarshal(line, &record); err == nil {
+			switch op {
+			case "set":
+				entries[record.K] = record.V
+			case "remove":
+				delete(entries, record.K)
+			}
+		}
+		op = ""
+	}
+	return scanner.Err()
+}
+
+// registryTime returns the time of a registry timestamp, whose second
+// element is in Unix seconds, or zero if it doesn't hold a plausible one.
+func registryTime(timestamp []float64) time.Time {
+	if len(timestamp) != 2 || timestamp[1] < 946684800 || timestamp[1] > float64(time.Now().Add(24*time.Hour).Unix()) {
+		return time.Time{}
+	}
+	return time.Unix(int64(timestamp[1]), 0)
+}
+
+// harvesterLag returns the bytes of the file past the offset Filebeat read
+// up to, 0 if its size is unknown or below the offset, as for a truncated
+// file.
+func harvesterLag(harvester Harvester) float64 {
+	if harvester.Size == nil || *harvester.Size < harvester.Offset {
+		return 0
+	}
+	return *harvester.Size - harvester.Offset
+}
+
+type filebeatHarvestersCollector struct {
+	beatInfo   *BeatInfo
+	stats      *Stats
+	options    Options
+	offset     *prometheus.Desc
+	size       *prometheus.Desc
+	lag        *prometheus.Desc
+	lastUpdate *prometheus.Desc
+	skipped    *prometheus.Desc
+	totalLag   *prometheus.Desc
+	lagging    *prometheus.Desc
+}
+
+// NewFilebeatHarvestersCollector constructor. The per-file metrics are
+// shaped by Options.MaxHarvesters, HashPaths and PerFile; the totals cover
+// every file.
+func NewFilebeatHarvestersCollector(beatInfo *BeatInfo, stats *Stats, options Options) prometheus.Collector {
+	return &filebeatHarvestersCollector{
+		beatInfo: beatInfo,
+		stats:    stats,
+		options:  options,
+		offset: prometheus.NewDesc(
+			prometheus.BuildFQName(beatInfo.namespace(), "filebeat_harvester", "offset_bytes"),
+			"Offset up to which Filebeat read the file.",
+			[]string{"file"}, nil,
+		),
+		size: prometheus.NewDesc(
+			prometheus.BuildFQName(beatInfo.namespace(), "filebeat_harvester", "size_bytes"),
+			"Size of the file read by Filebeat.",
+			[]string{"file"}, nil,
+		),
+		lag: prometheus.NewDesc(
+			prometheus.BuildFQName(beatInfo.namespace(), "filebeat_harvester", "lag_bytes"),
+			"Bytes of the file Filebeat hasn't read yet.",
+			[]string{"file"}, nil,
+		),
+		lastUpdate: prometheus.NewDesc(
+			prometheus.BuildFQName(beatInfo.namespace(), "filebeat_harvester", "last_update_timestamp_seconds"),
+			"Time Filebeat last recorded the state of the file.",
+			[]string{"file"}, nil,
+		),
+		skipped: prometheus.NewDesc(
+			prometheus.BuildFQName(beatInfo.namespace(), "filebeat_harvesters", "skipped"),
+			"Number of files left out for exceeding the limit of exported files.",
+			nil, nil,
+		),
+		totalLag: prometheus.NewDesc(
+			prometheus.BuildFQName(beatInfo.namespace(), "filebeat_harvesters", "lag_bytes"),
+			"Bytes of all files in the registry Filebeat hasn't read yet.",
+			nil, nil,
+		),
+		lagging: prometheus.NewDesc(
+			prometheus.BuildFQName(beatInfo.namespace(), "filebeat_harvesters", "lagging"),
+			"Number of files in the registry Filebeat hasn't read to the end.",
+			nil, nil,
+		),
+	}
+}
+
+// Describe returns all descriptions of the collector.
+func (c *filebeatHarvestersCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	ch <- c.offset
+	ch <- c.size
+	ch <- c.lag
+	ch <- c.lastUpdate
+	ch <- c.skipped
+	ch <- c.totalLag
+	ch <- c.lagging
+
+}
+
+// Collect returns the current state of all metrics of the collector.
+func (c *filebeatHarvestersCollector) Collect(ch chan<- prometheus.Metric) {
+
+	totalLag, lagging := 0.0, 0
+	for _, harvester := range c.stats.Harvesters {
+		if lag := harvesterLag(harvester); lag > 0 {
+			totalLag += lag
+			lagging++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(c.totalLag, prometheus.GaugeValue, totalLag)
+	ch <- prometheus.MustNewConstMetric(c.lagging, prometheus.GaugeValue, float64(lagging))
+	if !c.options.PerFile {
+		return
+	}
+
+	harvesters := c.stats.Harvesters
+	skipped := 0
+	if c.options.MaxHarvesters > 0 && len(harvesters) > c.options.MaxHarvesters {
+		skipped = len(harvesters) - c.options.MaxHarvesters
+		harvesters = harvesters[:c.options.MaxHarvesters]
+	}
+	for _, harvester := range harvesters {
+		file := harvester.Source
+		if c.options.HashPaths {
+			sum := sha256.Sum256([]byte(file))
+			file = hex.EncodeToString(sum[:])
+		}
+		ch <- prometheus.MustNewConstMetric(c.offset, prometheus.GaugeValue, harvester.Offset, file)
+		if harvester.Size != nil {
+			ch <- prometheus.MustNewConstMetric(c.size, prometheus.GaugeValue, *harvester.Size, file)
+			ch <- prometheus.MustNewConstMetric(c.lag, prometheus.GaugeValue, harvesterLag(harvester), file)
+		}
+		if !harvester.Updated.IsZero() {
+			ch <- prometheus.MustNewConstMetric(c.lastUpdate, prometheus.GaugeValue, float64(harvester.Updated.Unix()), file)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(c.skipped, prometheus.GaugeValue, float64(skipped))
+
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package collector
+
+import (
+	"os"
+	"syscall"
+)
+
+// sameFile reports whether info is the file Filebeat recorded as state, by
+// inode and device. Without a recorded state the path is trusted.
+func sameFile(info os.FileInfo, state *fileStateOS) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if state == nil || !ok {
+		return true
+	}
+	return uint64(stat.Ino) == state.Inode && uint64(stat.Dev) == state.Device
+}
@@ -0,0 +1,71 @@
+//go:build !windows
+// +build !windows
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// TestReadRegistryRotation checks that the size of a file is only reported
+// while it is the file recorded in the registry, for the log input and for
+// filestream.
+func TestReadRegistryRotation(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	identity := func(name string) (uint64, uint64) {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stat := info.Sys().(*syscall.Stat_t)
+		return uint64(stat.Ino), uint64(stat.Dev)
+	}
+
+	write("app.log", "0123456789")
+	write("stream.log", "0123456789")
+	appInode, appDevice := identity("app.log")
+	streamInode, streamDevice := identity("stream.log")
+	write("log.json", fmt.Sprintf(`{"op":"set","id":1}
+{"k":"filebeat::logs::native::%[1]d-%[2]d","v":{"FileStateOS":{"device":%[2]d,"inode":%[1]d},"offset":4,"source":%[3]q,"ttl":-1,"type":"log"}}
+{"op":"set","id":2}
+{"k":"filestream::my-input::native::%[4]d-%[5]d","v":{"cursor":{"offset":4},"meta":{"identifier_name":"native","source":%[6]q},"ttl":-1}}
+`, appInode, appDevice, filepath.Join(dir, "app.log"), streamInode, streamDevice, filepath.Join(dir, "stream.log")))
+
+	sizes := func() []*float64 {
+		harvesters, err := readRegistry(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(harvesters) != 2 {
+			t.Fatalf("harvesters = %+v, want 2", harvesters)
+		}
+		return []*float64{harvesters[0].Size, harvesters[1].Size}
+	}
+	for i, size := range sizes() {
+		if size == nil || *size != 10 {
+			t.Errorf("size of harvester %d = %v, want 10", i, size)
+		}
+	}
+
+	for _, name := range []string{"app.log", "stream.log"} {
+		if err := os.Rename(filepath.Join(dir, name), filepath.Join(dir, name+".1")); err != nil {
+			t.Fatal(err)
+		}
+		write(name, "012")
+	}
+	for i, size := range sizes() {
+		if size != nil {
+			t.Errorf("size of rotated harvester %d = %v, want unknown", i, *size)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func TestReadRegistry(t *testing.T) {
+	tests := []struct {
+		name    string
+		dir     string
+		want    []Harvester
+		wantErr bool
+	}{
+		{
+			name: "checkpoint and log",
+			dir:  "testdata/registry/filebeat",
+			want: []Harvester{
+				// The registry recorded another inode for app.log.
+				{Source: "testdata/registry/logs/app.log", Offset: 20, Updated: time.Unix(1700000100, 0)},
+				{Source: "testdata/registry/logs/missing.log", Offset: 7},
+				{Source: "testdata/registry/logs/stream.log", Offset: 1, Size: float(3), Updated: time.Unix(1700000200, 0)},
+			},
+		},
+		{name: "no registry", dir: "testdata/registry/logs"},
+		{name: "missing checkpoint", dir: "testdata/registry/broken-checkpoint", wantErr: true},
+		{name: "invalid log", dir: "testdata/registry/broken-log", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := readRegistry(test.dir)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err = %v, want error %v", err, test.wantErr)
+			}
+			if len(got) == 0 && len(test.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("harvesters = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHarvesterLag(t *testing.T) {
+	tests := []struct {
+		name      string
+		harvester Harvester
+		want      float64
+	}{
+		{"unknown size", Harvester{Offset: 10}, 0},
+		{"read to the end", Harvester{Offset: 10, Size: float(10)}, 0},
+		{"behind", Harvester{Offset: 10, Size: float(25)}, 15},
+		{"truncated", Harvester{Offset: 10, Size: float(4)}, 0},
+	}
+	for _, test := range tests {
+		if got := harvesterLag(test.harvester); got != test.want {
+			t.Errorf("%s: lag = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// TestFilebeatHarvestersCollector checks the series of the registry in
+// testdata, with the per-file series limited to two files.
+func TestFilebeatHarvestersCollector(t *testing.T) {
+	harvesters, err := readRegistry("testdata/registry/filebeat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		options Options
+	}{
+		{"harvesters-totals", Options{}},
+		{"harvesters", Options{PerFile: true, MaxHarvesters: 2}},
+		{"harvesters-hashed", Options{PerFile: true, HashPaths: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			beatInfo := &BeatInfo{Beat: "filebeat", Version: "8.12.0"}
+			c := NewFilebeatHarvestersCollector(beatInfo, &Stats{Harvesters: harvesters}, test.options)
+			compareGolden(t, c, test.name)
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// HeartbeatMonitors json structure of the monitors of one type
+type HeartbeatMonitors struct {
+	EndpointStarts float64 `json:"endpoint_starts"`
+	EndpointStops  float64 `json:"endpoint_stops"`
+	MonitorStarts  float64 `json:"monitor_starts"`
+	MonitorStops   float64 `json:"monitor_stops"`
+}
+
+// Heartbeat json structure
+type Heartbeat struct {
+	HTTP      HeartbeatMonitors `json:"http"`
+	ICMP      HeartbeatMonitors `json:"icmp"`
+	TCP       HeartbeatMonitors `json:"tcp"`
+	Browser   HeartbeatMonitors `json:"browser"`
+	Scheduler struct {
+		Jobs struct {
+			Active         float64 `json:"active"`
+			MissedDeadline float64 `json:"missed_deadline"`
+		} `json:"jobs"`
+		Tasks struct {
+			Active  float64 `json:"active"`
+			Waiting float64 `json:"waiting"`
+		} `json:"tasks"`
+	} `json:"scheduler"`
+}
+
+type heartbeatCollector struct {
+	beatInfo *BeatInfo
+	stats    *Stats
+	metrics  exportedMetrics
+}
+
+// NewHeartbeatCollector constructor
+func NewHeartbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
+	return &heartbeatCollector{
+		beatInfo: beatInfo,
+		stats:    stats,
+		metrics: exportedMetrics{
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "monitor", "starts_total"),
+					"Number of monitors started",
+					nil, prometheus.Labels{"type": "http"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.HTTP.MonitorStarts },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "monitor", "stops_total"),
+					"Number of monitors stopped",
+					nil, prometheus.Labels{"type": "http"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.HTTP.MonitorStops },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "monitor", "active"),
+					"Number of monitors running",
+					nil, prometheus.Labels{"type": "http"},
+				),
+				eval: func(stats *Stats) float64 {
+					return stats.Heartbeat.HTTP.MonitorStarts - stats.Heartbeat.HTTP.MonitorStops
+				},
+				valType: prometheus.GaugeValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "endpoint", "starts_total"),
+					"Number of monitored endpoints started",
+					nil, prometheus.Labels{"type": "http"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.HTTP.EndpointStarts },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "endpoint", "stops_total"),
+					"Number of monitored endpoints stopped",
+					nil, prometheus.Labels{"type": "http"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.HTTP.EndpointStops },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "monitor", "starts_total"),
+					"Number of monitors started",
+					nil, prometheus.Labels{"type": "icmp"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.ICMP.MonitorStarts },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "monitor", "stops_total"),
+					"Number of monitors stopped",
+					nil, prometheus.Labels{"type": "icmp"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.ICMP.MonitorStops },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "monitor", "active"),
+					"Number of monitors running",
+					nil, prometheus.Labels{"type": "icmp"},
+				),
+				eval: func(stats *Stats) float64 {
+					return stats.Heartbeat.ICMP.MonitorStarts - stats.Heartbeat.ICMP.MonitorStops
+				},
+				valType: prometheus.GaugeValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "endpoint", "starts_total"),
+					"Number of monitored endpoints started",
+					nil, prometheus.Labels{"type": "icmp"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.ICMP.EndpointStarts },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "endpoint", "stops_total"),
+					"Number of monitored endpoints stopped",
+					nil, prometheus.Labels{"type": "icmp"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.ICMP.EndpointStops },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "monitor", "starts_total"),
+					"Number of monitors started",
+					nil, prometheus.Labels{"type": "tcp"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.TCP.MonitorStarts },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "monitor", "stops_total"),
+					"Number of monitors stopped",
+					nil, prometheus.Labels{"type": "tcp"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.TCP.MonitorStops },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "monitor", "active"),
+					"Number of monitors running",
+					nil, prometheus.Labels{"type": "tcp"},
+				),
+				eval: func(stats *Stats) float64 {
+					return stats.Heartbeat.TCP.MonitorStarts - stats.Heartbeat.TCP.MonitorStops
+				},
+				valType: prometheus.GaugeValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "endpoint", "starts_total"),
+					"Number of monitored endpoints started",
+					nil, prometheus.Labels{"type": "tcp"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.TCP.EndpointStarts },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "endpoint", "stops_total"),
+					"Number of monitored endpoints stopped",
+					nil, prometheus.Labels{"type": "tcp"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.TCP.EndpointStops },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "monitor", "starts_total"),
+					"Number of monitors started",
+					nil, prometheus.Labels{"type": "browser"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.Browser.MonitorStarts },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "monitor", "stops_total"),
+					"Number of monitors stopped",
+					nil, prometheus.Labels{"type": "browser"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.Browser.MonitorStops },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "monitor", "active"),
+					"Number of monitors running",
+					nil, prometheus.Labels{"type": "browser"},
+				),
+				eval: func(stats *Stats) float64 {
+					return stats.Heartbeat.Browser.MonitorStarts - stats.Heartbeat.Browser.MonitorStops
+				},
+				valType: prometheus.GaugeValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "endpoint", "starts_total"),
+					"Number of monitored endpoints started",
+					nil, prometheus.Labels{"type": "browser"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.Browser.EndpointStarts },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "endpoint", "stops_total"),
+					"Number of monitored endpoints stopped",
+					nil, prometheus.Labels{"type": "browser"},
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.Browser.EndpointStops },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "scheduler", "jobs_active"),
+					"Number of scheduled jobs running",
+					nil, nil,
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.Scheduler.Jobs.Active },
+				valType: prometheus.GaugeValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "scheduler", "jobs_missed_deadline_total"),
+					"Number of scheduled jobs that missed their deadline",
+					nil, nil,
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.Scheduler.Jobs.MissedDeadline },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "scheduler", "tasks_active"),
+					"Number of scheduler tasks running",
+					nil, nil,
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.Scheduler.Tasks.Active },
+				valType: prometheus.GaugeValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "scheduler", "tasks_waiting"),
+					"Number of scheduler tasks waiting to run",
+					nil, nil,
+				),
+				eval:    func(stats *Stats) float64 { return stats.Heartbeat.Scheduler.Tasks.Waiting },
+				valType: prometheus.GaugeValue,
+			},
+		},
+	}
+}
+
+// Describe returns all descriptions of the collector.
+func (c *heartbeatCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.metrics.describe(ch)
+}
+
+// Collect returns the current state of all metrics of the collector.
+func (c *heartbeatCollector) Collect(ch chan<- prometheus.Metric) {
+	c.metrics.collect(ch, c.stats)
+}
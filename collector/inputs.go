@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// FilebeatInput json structure of an entry of the /inputs/ endpoint of
+// Filebeat. The metrics present depend on the input type, so missing ones
+// are left nil.
+type FilebeatInput struct {
+	ID                    string   `json:"id"`
+	Input                 string   `json:"input"`
+	EventsProcessedTotal  *float64 `json:"events_processed_total"`
+	EventsPublishedTotal  *float64 `json:"events_published_total"`
+	BytesProcessedTotal   *float64 `json:"bytes_processed_total"`
+	MessagesReadTotal     *float64 `json:"messages_read_total"`
+	ProcessingErrorsTotal *float64 `json:"processing_errors_total"`
+	FilesActive           *float64 `json:"files_active"`
+}
+
+type filebeatInputsCollector struct {
+	beatInfo *BeatInfo
+	stats    *Stats
+	limit    int
+	metrics  labelledMetrics
+	skipped  *prometheus.Desc
+}
+
+// inputValue adapts eval to the entries of labelledMetric, the inputs.
+func inputValue(eval func(input FilebeatInput) *float64) func(entry interface{}) *float64 {
+	return func(entry interface{}) *float64 { return eval(entry.(FilebeatInput)) }
+}
+
+func newInputMetric(beatInfo *BeatInfo, name, help string, eval func(input FilebeatInput) *float64, valType prometheus.ValueType) labelledMetric {
+	return newLabelledMetric(beatInfo, "filebeat_input", name, help, []string{"input_id", "input_type"}, inputValue(eval), valType)
+}
+
+// NewFilebeatInputsCollector constructor. Only the first limit inputs, by
+// ID, are exported if limit is above 0.
+func NewFilebeatInputsCollector(beatInfo *BeatInfo, stats *Stats, limit int) prometheus.Collector {
+	return &filebeatInputsCollector{
+		beatInfo: beatInfo,
+		stats:    stats,
+		limit:    limit,
+		metrics: labelledMetrics{
+			newInputMetric(beatInfo, "events_processed_total", "Events processed by the input.",
+				func(input FilebeatInput) *float64 { return input.EventsProcessedTotal }, beatInfo.cumulativeValueType()),
+			newInputMetric(beatInfo, "events_published_total", "Events published by the input.",
+				func(input FilebeatInput) *float64 { return input.EventsPublishedTotal }, beatInfo.cumulativeValueType()),
+			newInputMetric(beatInfo, "bytes_processed_total", "Bytes processed by the input.",
+				func(input FilebeatInput) *float64 { return input.BytesProcessedTotal }, beatInfo.cumulativeValueType()),
+			newInputMetric(beatInfo, "messages_read_total", "Messages read by the input.",
+				func(input FilebeatInput) *float64 { return input.MessagesReadTotal }, beatInfo.cumulativeValueType()),
+			newInputMetric(beatInfo, "processing_errors_total", "Processing errors of the input.",
+				func(input FilebeatInput) *float64 { return input.ProcessingErrorsTotal }, beatInfo.cumulativeValueType()),
+			newInputMetric(beatInfo, "files_active", "Files currently read by the input.",
+				func(input FilebeatInput) *float64 { return input.FilesActive }, prometheus.GaugeValue),
+		},
+		skipped: prometheus.NewDesc(
+			prometheus.BuildFQName(beatInfo.namespace(), "filebeat_inputs", "skipped"),
+			"Number of inputs left out for exceeding the limit of exported inputs.",
+			nil, nil,
+		),
+	}
+}
+
+// Describe returns all descriptions of the collector.
+func (c *filebeatInputsCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	c.metrics.describe(ch)
+	ch <- c.skipped
+
+}
+
+// Collect returns the current state of all metrics of the collector.
+func (c *filebeatInputsCollector) Collect(ch chan<- prometheus.Metric) {
+
+	inputs := c.stats.Inputs
+	skipped := 0
+	if c.limit > 0 && len(inputs) > c.limit {
+		skipped = len(inputs) - c.limit
+		inputs = inputs[:c.limit]
+	}
+	for _, input := range inputs {
+		c.metrics.collect(ch, input, input.ID, input.Input)
+	}
+	ch <- prometheus.MustNewConstMetric(c.skipped, prometheus.GaugeValue, float64(skipped))
+
+}
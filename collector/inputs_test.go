@@ -0,0 +1,85 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestFetchInputs checks that inputs are sorted by ID, keeping the first
+// of inputs listed more than once, that only the first limit inputs are
+// exported, and the series of all of them, missing the metrics their type
+// doesn't report.
+func TestFetchInputs(t *testing.T) {
+	const body = `[
+		{"id":"c","input":"filestream","events_processed_total":3},
+		{"id":"a","input":"filestream","events_processed_total":1},
+		{"id":"b","input":"log","events_processed_total":2,"events_published_total":2,"bytes_processed_total":20,"messages_read_total":2,"processing_errors_total":0,"files_active":1},
+		{"id":"a","input":"filestream","events_processed_total":10}
+	]`
+	tests := []struct {
+		name        string
+		limit       int
+		wantIDs     []string
+		wantValues  []float64
+		wantSkipped float64
+	}{
+		{"no limit", 0, []string{"a", "b", "c"}, []float64{1, 2, 3}, 0},
+		{"limit above inputs", 5, []string{"a", "b", "c"}, []float64{1, 2, 3}, 0},
+		{"limit", 2, []string{"a", "b"}, []float64{1, 2}, 1},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	beatURL, _ := url.Parse(server.URL)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := &mainCollector{client: server.Client(), beatURL: beatURL, Stats: &Stats{}}
+			if err := b.fetchInputs(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			beatInfo := &BeatInfo{Beat: "filebeat", Version: "8.12.0"}
+			if test.limit == 0 {
+				compareGolden(t, NewFilebeatInputsCollector(beatInfo, b.Stats, test.limit), "filebeat-inputs")
+			}
+			registry := prometheus.NewPedanticRegistry()
+			registry.MustRegister(NewFilebeatInputsCollector(beatInfo, b.Stats, test.limit))
+			families, err := registry.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []string
+			var values []float64
+			skipped := -1.0
+			for _, family := range families {
+				switch family.GetName() {
+				case "filebeat_filebeat_input_events_processed_total":
+					for _, metric := range family.GetMetric() {
+						for _, label := range metric.GetLabel() {
+							if label.GetName() == "input_id" {
+								ids = append(ids, label.GetValue())
+							}
+						}
+						values = append(values, metric.GetCounter().GetValue())
+					}
+				case "filebeat_filebeat_inputs_skipped":
+					skipped = family.GetMetric()[0].GetGauge().GetValue()
+				}
+			}
+			if !reflect.DeepEqual(ids, test.wantIDs) || !reflect.DeepEqual(values, test.wantValues) {
+				t.Errorf("inputs = %v with events %v, want %v with events %v", ids, values, test.wantIDs, test.wantValues)
+			}
+			if skipped != test.wantSkipped {
+				t.Errorf("skipped = %v, want %v", skipped, test.wantSkipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Journald json structure of the stats of a journal reader, as reported by
+// Journalbeat and by the journald input of Filebeat
+type Journald struct {
+	Entries struct {
+		Read float64 `json:"read"`
+	} `json:"entries"`
+	// Lag is how far the read position is behind the newest journal entry.
+	Lag struct {
+		MS float64 `json:"ms"`
+	} `json:"lag"`
+	Restarts float64 `json:"restarts"`
+}
+
+type journaldCollector struct {
+	beatInfo *BeatInfo
+	stats    *Stats
+	metrics  exportedMetrics
+}
+
+// NewJournaldCollector constructor
+func NewJournaldCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
+	journald := func(stats *Stats) *Journald {
+		if beatInfo.kind() == "journalbeat" {
+			return &stats.Journalbeat
+		}
+		return &stats.Filebeat.Input.Journald
+	}
+	return &journaldCollector{
+		beatInfo: beatInfo,
+		stats:    stats,
+		metrics: exportedMetrics{
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "journald", "entries_read_total"),
+					"Number of journal entries read",
+					nil, nil,
+				),
+				eval:    func(stats *Stats) float64 { return journald(stats).Entries.Read },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "journald", "lag_seconds"),
+					"Time the read position is behind the newest journal entry",
+					nil, nil,
+				),
+				eval: func(stats *Stats) float64 {
+					return (time.Duration(journald(stats).Lag.MS) * time.Millisecond).Seconds()
+				},
+				valType: prometheus.GaugeValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "journald", "restarts_total"),
+					"Number of times reading the journal was restarted",
+					nil, nil,
+				),
+				eval:    func(stats *Stats) float64 { return journald(stats).Restarts },
+				valType: prometheus.CounterValue,
+			},
+		},
+	}
+}
+
+// Describe returns all descriptions of the collector.
+func (c *journaldCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.metrics.describe(ch)
+}
+
+// Collect returns the current state of all metrics of the collector.
+func (c *journaldCollector) Collect(ch chan<- prometheus.Metric) {
+	c.metrics.collect(ch, c.stats)
+}
@@ -1,6 +1,9 @@
 package collector
 
 import (
+	"encoding/json"
+	"fmt"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -16,6 +19,52 @@ type LibBeat struct {
 	} `json:"config"`
 	Output   LibBeatOutput   `json:"output"`
 	Pipeline LibBeatPipeline `json:"pipeline"`
+	// Autodiscover is nil for Beats that don't use autodiscover.
+	Autodiscover *LibBeatAutodiscover `json:"autodiscover"`
+	Processors   LibBeatProcessors    `json:"processors"`
+}
+
+//LibBeatProcessor json structure
+type LibBeatProcessor struct {
+	Events struct {
+		Processed float64 `json:"processed"`
+		Dropped   float64 `json:"dropped"`
+	} `json:"events"`
+	Failures float64 `json:"failures"`
+}
+
+// LibBeatProcessors holds the stats of the processors by name, e.g.
+// drop_event or dissect.
+type LibBeatProcessors map[string]LibBeatProcessor
+
+// UnmarshalJSON decodes the processors section, skipping the entries that
+// aren't processors.
+func (p *LibBeatProcessors) UnmarshalJSON(data []byte) error {
+	var processors map[string]json.RawMessage
+	if err := json.Unmarshal(data, &processors); err != nil {
+		return err
+	}
+	*p = LibBeatProcessors{}
+	for name, raw := range processors {
+		var processor LibBeatProcessor
+		if err := json.Unmarshal(raw, &processor); err != nil {
+			continue
+		}
+		(*p)[name] = processor
+	}
+	return nil
+}
+
+//LibBeatAutodiscover json structure
+type LibBeatAutodiscover struct {
+	Events struct {
+		Received float64 `json:"received"`
+	} `json:"events"`
+	Configs struct {
+		Started float64 `json:"started"`
+		Stopped float64 `json:"stopped"`
+	} `json:"configs"`
+	Errors float64 `json:"errors"`
 }
 
 //LibBeatEvents json structure
@@ -29,6 +78,7 @@ type LibBeatEvents struct {
 	Filtered   float64 `json:"filtered"`
 	Published  float64 `json:"published"`
 	Retry      float64 `json:"retry"`
+	Total      float64 `json:"total"`
 }
 
 //LibBeatOutputBytesErrors json structure
@@ -50,181 +100,414 @@ type LibBeatPipeline struct {
 	Clients float64       `json:"clients"`
 	Events  LibBeatEvents `json:"events"`
 	Queue   struct {
-		Acked float64 `json:"acked"`
+		Acked     float64 `json:"acked"`
+		MaxEvents float64 `json:"max_events"`
+		MaxBytes  float64 `json:"max_bytes"`
+		Filled    struct {
+			Events float64 `json:"events"`
+			Bytes  float64 `json:"bytes"`
+			Pct    float64 `json:"pct"`
+		} `json:"filled"`
+		Added struct {
+			Events float64 `json:"events"`
+		} `json:"added"`
+		Consumed struct {
+			Events float64 `json:"events"`
+		} `json:"consumed"`
 	} `json:"queue"`
 }
 
+// outputLabelNames returns the name of the output label, which the original
+// exporter, exported with LegacyNames, had not.
+func (b *BeatInfo) outputLabelNames() []string {
+	if b.Naming.LegacyNames {
+		return nil
+	}
+	return []string{"output"}
+}
+
+// outputLabel returns the value of the output label, the type of the
+// output the Beat is configured with, e.g. elasticsearch.
+func (b *BeatInfo) outputLabel(stats *Stats) []string {
+	if b.Naming.LegacyNames {
+		return nil
+	}
+	return []string{stats.LibBeat.Output.Type}
+}
+
 type libbeatCollector struct {
-	beatInfo *BeatInfo
-	stats    *Stats
-	metrics  exportedMetrics
+	beatInfo   *BeatInfo
+	stats      *Stats
+	metrics    exportedMetrics
+	outputType *prometheus.Desc
+	batchSize  *prometheus.Desc
+	// diskQueue is only collected from Beats with a disk queue, which
+	// report its maximum size.
+	diskQueue exportedMetrics
+	// autodiscover is only collected from Beats reporting autodiscover
+	// stats.
+	autodiscover exportedMetrics
+	processors   labelledMetrics
+}
+
+// processorValue adapts eval to the entries of labelledMetric, the
+// processors.
+func processorValue(eval func(processor LibBeatProcessor) float64) func(entry interface{}) *float64 {
+	return func(entry interface{}) *float64 {
+		value := eval(entry.(LibBeatProcessor))
+		return &value
+	}
+}
+
+func newProcessorMetric(beatInfo *BeatInfo, name, help string, eval func(processor LibBeatProcessor) float64) labelledMetric {
+	return newLabelledMetric(beatInfo, "processors", name, help, []string{"processor"}, processorValue(eval), prometheus.CounterValue)
+}
+
+// libbeatEvents returns the events stats of the output or the pipeline.
+type libbeatEvents func(stats *Stats) LibBeatEvents
+
+func outputEvents(stats *Stats) LibBeatEvents   { return stats.LibBeat.Output.Events }
+func pipelineEvents(stats *Stats) LibBeatEvents { return stats.LibBeat.Pipeline.Events }
+
+// libbeatEventValues reads the events stats by type.
+var libbeatEventValues = map[string]func(events LibBeatEvents) float64{
+	"acked":      func(events LibBeatEvents) float64 { return events.Acked },
+	"active":     func(events LibBeatEvents) float64 { return events.Active },
+	"batches":    func(events LibBeatEvents) float64 { return events.Batches },
+	"dropped":    func(events LibBeatEvents) float64 { return events.Dropped },
+	"duplicates": func(events LibBeatEvents) float64 { return events.Duplicates },
+	"failed":     func(events LibBeatEvents) float64 { return events.Failed },
+	"filtered":   func(events LibBeatEvents) float64 { return events.Filtered },
+	"published":  func(events LibBeatEvents) float64 { return events.Published },
+	"retry":      func(events LibBeatEvents) float64 { return events.Retry },
+	"total":      func(events LibBeatEvents) float64 { return events.Total },
+}
+
+// The types of events the output and the pipeline report.
+var (
+	outputEventTypes   = []string{"acked", "active", "batches", "dropped", "duplicates", "failed", "total"}
+	pipelineEventTypes = []string{"active", "dropped", "failed", "filtered", "published", "retry", "total"}
+)
+
+// libbeatEventName returns the name of the events of type eventType of
+// section, e.g. libbeat_output_events_acked_total, a counter but for the
+// active events, a gauge.
+func libbeatEventName(beatInfo *BeatInfo, section, eventType string) string {
+	name := section + "_events_" + eventType + "_total"
+	switch eventType {
+	case "active":
+		name = section + "_events_active"
+	case "total":
+		name = section + "_events_total"
+	}
+	return prometheus.BuildFQName(beatInfo.namespace(), "libbeat", name)
+}
+
+// libbeatEventLegacyName returns the name of the events of section as
+// earlier versions exported them, a single family labelled by type, e.g.
+// libbeat_output_events.
+func libbeatEventLegacyName(beatInfo *BeatInfo, section string) string {
+	return prometheus.BuildFQName(beatInfo.namespace(), "libbeat", section+"_events")
+}
+
+// libbeatEventMetrics returns the metrics of the given types of the events
+// of section, output or pipeline, named by libbeatEventName. With legacy
+// types they are exported as earlier versions did, under
+// libbeatEventLegacyName, without the total under LegacyNames.
+func libbeatEventMetrics(beatInfo *BeatInfo, section string, events libbeatEvents, labelNames []string, labels func(stats *Stats) []string, types []string) exportedMetrics {
+	var metrics exportedMetrics
+	for _, eventType := range types {
+		value := libbeatEventValues[eventType]
+		metric := exportedMetric{
+			desc: prometheus.NewDesc(
+				libbeatEventName(beatInfo, section, eventType),
+				"libbeat."+section+".events."+eventType,
+				labelNames, nil,
+			),
+			eval:    func(stats *Stats) float64 { return value(events(stats)) },
+			labels:  labels,
+			valType: prometheus.CounterValue,
+		}
+		switch {
+		case beatInfo.legacyTypes():
+			if beatInfo.Naming.LegacyNames && eventType == "total" {
+				continue
+			}
+			metric.desc = prometheus.NewDesc(
+				libbeatEventLegacyName(beatInfo, section),
+				"libbeat."+section+".events",
+				labelNames, prometheus.Labels{"type": eventType},
+			)
+			metric.valType = prometheus.UntypedValue
+		case eventType == "active":
+			metric.valType = prometheus.GaugeValue
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
 }
 
-var libbeatOutputType *prometheus.Desc
+// libbeatEventRenames returns the events series of the output and the
+// pipeline and the module lifecycle series, from their names under
+// LegacyNames to the current ones.
+func libbeatEventRenames(beatInfo *BeatInfo) []Rename {
+	var renames []Rename
+	for _, section := range []struct {
+		name  string
+		types []string
+	}{{"output", outputEventTypes}, {"pipeline", pipelineEventTypes}} {
+		for _, eventType := range section.types {
+			if eventType == "total" {
+				continue
+			}
+			renames = append(renames, Rename{
+				Old: fmt.Sprintf("%s{type=%q}", libbeatEventLegacyName(beatInfo, section.name), eventType),
+				New: libbeatEventName(beatInfo, section.name, eventType),
+			})
+		}
+	}
+	renames = append(renames, Rename{
+		Old: prometheus.BuildFQName(beatInfo.namespace(), "libbeat", "pipeline_queue") + `{type="acked"}`,
+		New: prometheus.BuildFQName(beatInfo.namespace(), "libbeat", "pipeline_queue_acked_events_total"),
+	})
+	for _, field := range []string{"running", "starts", "stops"} {
+		renames = append(renames, Rename{
+			Old: prometheus.BuildFQName(beatInfo.namespace(), "libbeat", "config") + fmt.Sprintf("{module=%q}", field),
+			New: configModuleName(beatInfo, field),
+		})
+	}
+	return renames
+}
+
+// queueAcked returns the metric of the events acknowledged by the queue, a
+// counter, or with legacy types the untyped libbeat_pipeline_queue labelled
+// by type.
+func queueAcked(beatInfo *BeatInfo) exportedMetric {
+	metric := exportedMetric{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(beatInfo.namespace(), "libbeat", "pipeline_queue_acked_events_total"),
+			"libbeat.pipeline.queue.acked",
+			nil, nil,
+		),
+		eval: func(stats *Stats) float64 {
+			return stats.LibBeat.Pipeline.Queue.Acked
+		},
+		valType: prometheus.CounterValue,
+	}
+	if beatInfo.legacyTypes() {
+		metric.desc = prometheus.NewDesc(
+			prometheus.BuildFQName(beatInfo.namespace(), "libbeat", "pipeline_queue"),
+			"libbeat.pipeline.queue",
+			nil, prometheus.Labels{"type": "acked"},
+		)
+		metric.valType = prometheus.UntypedValue
+	}
+	return metric
+}
+
+// configModule returns the lifecycle metrics of the reloaded modules, the
+// running gauge and the starts and stops counters, or with legacy types the
+// libbeat_config gauges labelled by module.
+func configModule(beatInfo *BeatInfo) exportedMetrics {
+	values := []struct {
+		name    string
+		eval    func(stats *Stats) float64
+		valType prometheus.ValueType
+	}{
+		{"running", func(stats *Stats) float64 { return stats.LibBeat.Config.Module.Running }, prometheus.GaugeValue},
+		{"starts", func(stats *Stats) float64 { return stats.LibBeat.Config.Module.Starts }, prometheus.CounterValue},
+		{"stops", func(stats *Stats) float64 { return stats.LibBeat.Config.Module.Stops }, prometheus.CounterValue},
+	}
+	metrics := make(exportedMetrics, 0, len(values))
+	for _, value := range values {
+		metric := exportedMetric{
+			desc: prometheus.NewDesc(
+				configModuleName(beatInfo, value.name),
+				"libbeat.config.module."+value.name,
+				nil, nil,
+			),
+			eval:    value.eval,
+			valType: value.valType,
+		}
+		if beatInfo.legacyTypes() {
+			metric.desc = prometheus.NewDesc(
+				prometheus.BuildFQName(beatInfo.namespace(), "libbeat", "config"),
+				"libbeat.config.module",
+				nil, prometheus.Labels{"module": value.name},
+			)
+			metric.valType = prometheus.GaugeValue
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// configModuleName returns the name of the module lifecycle metric of the
+// given libbeat.config.module field.
+func configModuleName(beatInfo *BeatInfo, field string) string {
+	name := "config_module_" + field
+	if field != "running" {
+		name += "_total"
+	}
+	return prometheus.BuildFQName(beatInfo.namespace(), "libbeat", name)
+}
 
 // NewLibBeatCollector constructor
 func NewLibBeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
-	return &libbeatCollector{
+	c := &libbeatCollector{
 		beatInfo: beatInfo,
 		stats:    stats,
-		metrics: exportedMetrics{
+		outputType: prometheus.NewDesc(
+			prometheus.BuildFQName(beatInfo.namespace(), "libbeat", "output_total"),
+			"libbeat.output.type",
+			[]string{"type"}, nil,
+		),
+		batchSize: prometheus.NewDesc(
+			prometheus.BuildFQName(beatInfo.namespace(), "libbeat", "output_events_per_batch"),
+			"libbeat.output.events.total / libbeat.output.events.batches",
+			beatInfo.outputLabelNames(), nil,
+		),
+		processors: labelledMetrics{
+			newProcessorMetric(beatInfo, "events_processed_total", "Events processed by the processor.",
+				func(processor LibBeatProcessor) float64 { return processor.Events.Processed }),
+			newProcessorMetric(beatInfo, "events_dropped_total", "Events dropped by the processor, e.g. by drop_event.",
+				func(processor LibBeatProcessor) float64 { return processor.Events.Dropped }),
+			newProcessorMetric(beatInfo, "failures_total", "Events the processor failed on, e.g. dissect failing to tokenize.",
+				func(processor LibBeatProcessor) float64 { return processor.Failures }),
+		},
+		autodiscover: exportedMetrics{
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat_config", "reloads_total"),
-					"libbeat.config.reloads",
+					prometheus.BuildFQName(beatInfo.namespace(), "libbeat_autodiscover", "events_received_total"),
+					"libbeat.autodiscover.events.received",
 					nil, nil,
 				),
 				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Config.Reloads
+					return stats.LibBeat.Autodiscover.Events.Received
 				},
 				valType: prometheus.CounterValue,
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "config"),
-					"libbeat.config.module",
-					nil, prometheus.Labels{"module": "running"},
-				),
-				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Config.Module.Running
-				},
-				valType: prometheus.GaugeValue,
-			},
-			{
-				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "config"),
-					"libbeat.config.module",
-					nil, prometheus.Labels{"module": "starts"},
-				),
-				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Config.Module.Starts
-				},
-				valType: prometheus.GaugeValue,
-			},
-			{
-				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "config"),
-					"libbeat.config.module",
-					nil, prometheus.Labels{"module": "stops"},
-				),
-				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Config.Module.Stops
-				},
-				valType: prometheus.GaugeValue,
-			},
-			{
-				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "output_read_bytes_total"),
-					"libbeat.output.read.bytes",
+					prometheus.BuildFQName(beatInfo.namespace(), "libbeat_autodiscover", "configs_started_total"),
+					"libbeat.autodiscover.configs.started",
 					nil, nil,
 				),
 				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Output.Read.Bytes
+					return stats.LibBeat.Autodiscover.Configs.Started
 				},
 				valType: prometheus.CounterValue,
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "output_read_errors_total"),
-					"libbeat.output.read.errors",
+					prometheus.BuildFQName(beatInfo.namespace(), "libbeat_autodiscover", "configs_stopped_total"),
+					"libbeat.autodiscover.configs.stopped",
 					nil, nil,
 				),
 				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Output.Read.Errors
+					return stats.LibBeat.Autodiscover.Configs.Stopped
 				},
 				valType: prometheus.CounterValue,
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "output_write_bytes_total"),
-					"libbeat.output.write.bytes",
+					prometheus.BuildFQName(beatInfo.namespace(), "libbeat_autodiscover", "errors_total"),
+					"libbeat.autodiscover.errors",
 					nil, nil,
 				),
 				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Output.Write.Bytes
+					return stats.LibBeat.Autodiscover.Errors
 				},
 				valType: prometheus.CounterValue,
 			},
+		},
+		diskQueue: exportedMetrics{
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "output_write_errors_total"),
-					"libbeat.output.write.errors",
+					prometheus.BuildFQName(beatInfo.namespace(), "queue_disk", "size_bytes"),
+					"libbeat.pipeline.queue.filled.bytes",
 					nil, nil,
 				),
 				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Output.Write.Errors
+					return stats.LibBeat.Pipeline.Queue.Filled.Bytes
 				},
-				valType: prometheus.CounterValue,
+				valType: prometheus.GaugeValue,
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "output_events"),
-					"libbeat.output.events",
-					nil, prometheus.Labels{"type": "acked"},
+					prometheus.BuildFQName(beatInfo.namespace(), "queue_disk", "max_size_bytes"),
+					"libbeat.pipeline.queue.max_bytes",
+					nil, nil,
 				),
 				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Output.Events.Acked
+					return stats.LibBeat.Pipeline.Queue.MaxBytes
 				},
-				valType: prometheus.UntypedValue,
+				valType: prometheus.GaugeValue,
 			},
+		},
+		metrics: exportedMetrics{
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "output_events"),
-					"libbeat.output.events",
-					nil, prometheus.Labels{"type": "active"},
+					prometheus.BuildFQName(beatInfo.namespace(), "libbeat_config", "reloads_total"),
+					"libbeat.config.reloads",
+					nil, nil,
 				),
 				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Output.Events.Active
+					return stats.LibBeat.Config.Reloads
 				},
-				valType: prometheus.UntypedValue,
+				valType: prometheus.CounterValue,
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "output_events"),
-					"libbeat.output.events",
-					nil, prometheus.Labels{"type": "batches"},
+					prometheus.BuildFQName(beatInfo.namespace(), "libbeat", "output_read_bytes_total"),
+					"libbeat.output.read.bytes",
+					beatInfo.outputLabelNames(), nil,
 				),
 				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Output.Events.Batches
+					return stats.LibBeat.Output.Read.Bytes
 				},
-				valType: prometheus.UntypedValue,
+				labels:  beatInfo.outputLabel,
+				valType: prometheus.CounterValue,
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "output_events"),
-					"libbeat.output.events",
-					nil, prometheus.Labels{"type": "dropped"},
+					prometheus.BuildFQName(beatInfo.namespace(), "libbeat", "output_read_errors_total"),
+					"libbeat.output.read.errors",
+					beatInfo.outputLabelNames(), nil,
 				),
 				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Output.Events.Dropped
+					return stats.LibBeat.Output.Read.Errors
 				},
-				valType: prometheus.UntypedValue,
+				labels:  beatInfo.outputLabel,
+				valType: prometheus.CounterValue,
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "output_events"),
-					"libbeat.output.events",
-					nil, prometheus.Labels{"type": "duplicates"},
+					prometheus.BuildFQName(beatInfo.namespace(), "libbeat", "output_write_bytes_total"),
+					"libbeat.output.write.bytes",
+					beatInfo.outputLabelNames(), nil,
 				),
 				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Output.Events.Duplicates
+					return stats.LibBeat.Output.Write.Bytes
 				},
-				valType: prometheus.UntypedValue,
+				labels:  beatInfo.outputLabel,
+				valType: prometheus.CounterValue,
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "output_events"),
-					"libbeat.output.events",
-					nil, prometheus.Labels{"type": "failed"},
+					prometheus.BuildFQName(beatInfo.namespace(), "libbeat", "output_write_errors_total"),
+					"libbeat.output.write.errors",
+					beatInfo.outputLabelNames(), nil,
 				),
 				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Output.Events.Failed
+					return stats.LibBeat.Output.Write.Errors
 				},
-				valType: prometheus.UntypedValue,
+				labels:  beatInfo.outputLabel,
+				valType: prometheus.CounterValue,
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "pipeline_clients"),
+					prometheus.BuildFQName(beatInfo.namespace(), "libbeat", "pipeline_clients"),
 					"libbeat.pipeline.clients",
 					nil, nil,
 				),
@@ -235,110 +518,103 @@ func NewLibBeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "pipeline_queue"),
-					"libbeat.pipeline.queue",
-					nil, prometheus.Labels{"type": "acked"},
-				),
-				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Pipeline.Queue.Acked
-				},
-				valType: prometheus.UntypedValue,
-			},
-			{
-				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "pipeline_events"),
-					"libbeat.pipeline.events",
-					nil, prometheus.Labels{"type": "active"},
-				),
-				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Pipeline.Events.Active
-				},
-				valType: prometheus.UntypedValue,
-			},
-			{
-				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "pipeline_events"),
-					"libbeat.pipeline.events",
-					nil, prometheus.Labels{"type": "dropped"},
+					prometheus.BuildFQName(beatInfo.namespace(), "libbeat", "pipeline_queue_max_events"),
+					"libbeat.pipeline.queue.max_events",
+					nil, nil,
 				),
 				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Pipeline.Events.Dropped
+					return stats.LibBeat.Pipeline.Queue.MaxEvents
 				},
-				valType: prometheus.UntypedValue,
+				valType: prometheus.GaugeValue,
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "pipeline_events"),
-					"libbeat.pipeline.events",
-					nil, prometheus.Labels{"type": "failed"},
+					prometheus.BuildFQName(beatInfo.namespace(), "libbeat", "pipeline_queue_filled_events"),
+					"libbeat.pipeline.queue.filled.events",
+					nil, nil,
 				),
 				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Pipeline.Events.Failed
+					return stats.LibBeat.Pipeline.Queue.Filled.Events
 				},
-				valType: prometheus.UntypedValue,
+				valType: prometheus.GaugeValue,
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "pipeline_events"),
-					"libbeat.pipeline.events",
-					nil, prometheus.Labels{"type": "filtered"},
+					prometheus.BuildFQName(beatInfo.namespace(), "libbeat", "pipeline_queue_filled_ratio"),
+					"libbeat.pipeline.queue.filled.pct",
+					nil, nil,
 				),
 				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Pipeline.Events.Filtered
+					return stats.LibBeat.Pipeline.Queue.Filled.Pct
 				},
-				valType: prometheus.UntypedValue,
+				valType: prometheus.GaugeValue,
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "pipeline_events"),
-					"libbeat.pipeline.events",
-					nil, prometheus.Labels{"type": "published"},
+					prometheus.BuildFQName(beatInfo.namespace(), "libbeat", "pipeline_queue_added_events_total"),
+					"libbeat.pipeline.queue.added.events",
+					nil, nil,
 				),
 				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Pipeline.Events.Published
+					return stats.LibBeat.Pipeline.Queue.Added.Events
 				},
-				valType: prometheus.UntypedValue,
+				valType: prometheus.CounterValue,
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "libbeat", "pipeline_events"),
-					"libbeat.pipeline.events",
-					nil, prometheus.Labels{"type": "retry"},
+					prometheus.BuildFQName(beatInfo.namespace(), "libbeat", "pipeline_queue_consumed_events_total"),
+					"libbeat.pipeline.queue.consumed.events",
+					nil, nil,
 				),
 				eval: func(stats *Stats) float64 {
-					return stats.LibBeat.Pipeline.Events.Retry
+					return stats.LibBeat.Pipeline.Queue.Consumed.Events
 				},
-				valType: prometheus.UntypedValue,
+				valType: prometheus.CounterValue,
 			},
 		},
 	}
+	c.metrics = append(c.metrics, libbeatEventMetrics(beatInfo, "output", outputEvents, beatInfo.outputLabelNames(), beatInfo.outputLabel, outputEventTypes)...)
+	c.metrics = append(c.metrics, libbeatEventMetrics(beatInfo, "pipeline", pipelineEvents, nil, nil, pipelineEventTypes)...)
+	c.metrics = append(c.metrics, queueAcked(beatInfo))
+	c.metrics = append(c.metrics, configModule(beatInfo)...)
+	return c
 }
 
 // Describe returns all descriptions of the collector.
 func (c *libbeatCollector) Describe(ch chan<- *prometheus.Desc) {
 
-	for _, metric := range c.metrics {
-		ch <- metric.desc
-	}
-
-	libbeatOutputType = prometheus.NewDesc(
-		prometheus.BuildFQName(c.beatInfo.Beat, "libbeat", "output_total"),
-		"libbeat.output.type",
-		[]string{"type"}, nil,
-	)
+	c.metrics.describe(ch)
+	c.diskQueue.describe(ch)
+	c.autodiscover.describe(ch)
+	c.processors.describe(ch)
 
-	ch <- libbeatOutputType
+	ch <- c.outputType
+	if c.beatInfo.Naming.DerivedMetrics {
+		ch <- c.batchSize
+	}
 
 }
 
 // Collect returns the current state of all metrics of the collector.
 func (c *libbeatCollector) Collect(ch chan<- prometheus.Metric) {
 
-	for _, i := range c.metrics {
-		ch <- prometheus.MustNewConstMetric(i.desc, i.valType, i.eval(c.stats))
+	c.metrics.collect(ch, c.stats)
+	if c.stats.LibBeat.Pipeline.Queue.MaxBytes > 0 {
+		c.diskQueue.collect(ch, c.stats)
+	}
+	if c.stats.LibBeat.Autodiscover != nil {
+		c.autodiscover.collect(ch, c.stats)
+	}
+	for name, processor := range c.stats.LibBeat.Processors {
+		c.processors.collect(ch, processor, name)
 	}
 
 	// output.type with dynamic label
-	ch <- prometheus.MustNewConstMetric(libbeatOutputType, prometheus.CounterValue, float64(1), c.stats.LibBeat.Output.Type)
+	ch <- prometheus.MustNewConstMetric(c.outputType, prometheus.CounterValue, float64(1), c.stats.LibBeat.Output.Type)
+
+	// average batch size since the Beat started, once it sent a batch
+	if events := c.stats.LibBeat.Output.Events; c.beatInfo.Naming.DerivedMetrics && events.Batches > 0 {
+		ch <- prometheus.MustNewConstMetric(c.batchSize, prometheus.GaugeValue, events.Total/events.Batches, c.beatInfo.outputLabel(c.stats)...)
+	}
 
 }
@@ -1,12 +1,21 @@
 package collector
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
@@ -21,16 +30,162 @@ type mainCollector struct {
 	beatInfo   *BeatInfo
 	targetDesc *prometheus.Desc
 	targetUp   *prometheus.Desc
+	infoDesc   *prometheus.Desc
 	metrics    exportedMetrics
-	systemBeat bool
+	enabled    map[string]bool
+	options    Options
+	retries    *prometheus.Desc
+	tooLarge   *prometheus.Desc
+	beatUp     *prometheus.Desc
+	duration   *prometheus.Desc
+	errorsDesc *prometheus.Desc
+	histogram  prometheus.Histogram
+	latency    prometheus.Histogram
+	infoErrors *prometheus.Desc
+
+	// collectMu serializes scrapes, which decode into the shared Stats.
+	collectMu sync.Mutex
+
+	mu         sync.Mutex
+	lastScrape ScrapeStatus
+	retryCount int
+	// tooLargeCount is the number of responses dropped for exceeding
+	// Options.MaxResponseBytes.
+	tooLargeCount int
+	// infoFailures is the number of failed pings of the root endpoint.
+	infoFailures int
+	// scrapeErrors counts the failed scrapes by reason.
+	scrapeErrors map[string]int
+	// openUntil is the end of the cooldown of an open circuit breaker.
+	openUntil time.Time
+
+	// unknown holds the fields of the last stats missing from Stats, with
+	// Options.UnknownFields.
+	unknown []unknownField
+}
+
+// Options holds the settings of how a Beat is scraped.
+type Options struct {
+	// Retries is the number of times a request failing to connect to the
+	// Beat is retried within a scrape.
+	Retries int
+	// RetryBackoff is the delay before the first retry, doubled after
+	// every further failure.
+	RetryBackoff time.Duration
+	// RetryJitter is the fraction of the delay, between 0 and 1, added at
+	// random so that retries of many targets don't line up.
+	RetryJitter float64
+	// BreakerFailures is the number of consecutive failed scrapes after
+	// which requests to the Beat are skipped for BreakerCooldown, 0 to
+	// never skip them.
+	BreakerFailures int
+	BreakerCooldown time.Duration
+	// Reconnect closes the connections kept open since the previous scrape,
+	// so that the host of the Beat is resolved again on every scrape.
+	Reconnect bool
+	// MaxResponseBytes is the size above which responses of the Beat are
+	// dropped, 0 for no limit.
+	MaxResponseBytes int64
+	// Ping requests the root endpoint of the Beat along with its stats on
+	// every scrape and exports the outcome as beat_up, telling a Beat that
+	// is down apart from a broken stats endpoint.
+	Ping bool
+	// DurationHistogram adds a histogram of the time taken to fetch and
+	// decode the stats of the Beat to the gauge of the last scrape.
+	DurationHistogram bool
+	// LatencyHistogram exports a histogram of the time until the Beat
+	// answers a request to its stats endpoint, observed for every attempt
+	// that got a response.
+	LatencyHistogram bool
+	// UnknownFields exports the numeric fields of the stats that no
+	// collector covers as untyped metrics named after their path.
+	UnknownFields bool
+	// MaxInputs is the number of Filebeat inputs exported by the
+	// filebeat-inputs collector, 0 for no limit.
+	MaxInputs int
+	// RegistryPath is the registry directory of Filebeat read by the
+	// filebeat-harvesters collector, which exports MaxHarvesters files at
+	// most, 0 for no limit, labelled by the hash of their path with
+	// HashPaths. Only the totals over all files are exported unless
+	// PerFile is set.
+	RegistryPath  string
+	MaxHarvesters int
+	HashPaths     bool
+	PerFile       bool
+	// Naming selects the names and types of the exported metrics.
+	Naming Naming
 }
 
+// errCircuitOpen is the scrape error of a Beat whose circuit breaker is open.
+var errCircuitOpen = errors.New("circuit breaker open, skipping request to Beat")
+
+// ScrapeStatus is the outcome of the last scrape of a Beat.
+type ScrapeStatus struct {
+	Time     time.Time
+	Duration time.Duration
+	Err      error
+	// Failures is the number of consecutive failed scrapes.
+	Failures int
+}
+
+// StatusReporter is implemented by collectors recording their last scrape.
+type StatusReporter interface {
+	LastScrape() ScrapeStatus
+}
+
+// ContextCollector is implemented by collectors whose requests to the Beat
+// can be bounded by a context, e.g. the deadline of a scrape.
+type ContextCollector interface {
+	prometheus.Collector
+	CollectContext(ctx context.Context, ch chan<- prometheus.Metric)
+}
+
+// DefaultCollectors lists the sub-collectors that can be switched on or off
+// per target, and whether they are enabled by default.
+var DefaultCollectors = map[string]bool{
+	"system":     false,
+	"runtime":    true,
+	"libbeat":    true,
+	"registrar":  true,
+	"filebeat":   true,
+	"metricbeat": true,
+	"auditd":     true,
+	"heartbeat":  true,
+	"packetbeat": true,
+	"journald":   true,
+	"apm-server": true,
+	"winlogbeat": true,
+
+	"filebeat-inputs":     false,
+	"filebeat-harvesters": false,
+	"dataset":             false,
+}
+
+// BeatTypes lists the Beat types with collectors of their own, which custom
+// Beats can be scraped as.
+var BeatTypes = []string{"filebeat", "metricbeat", "heartbeat", "packetbeat", "journalbeat", "apm-server", "winlogbeat"}
+
 // HackfixRegex regex to replace JSON part
 var HackfixRegex = regexp.MustCompile("\"time\":(\\d+)") // replaces time:123 to time.ms:123, only filebeat has different naming of time metric
 
-// NewMainCollector constructor
-func NewMainCollector(client *http.Client, url *url.URL, name string, beatInfo *BeatInfo, systemBeat bool) prometheus.Collector {
-	instance := fmt.Sprintf("%s:%s", url.Hostname(), url.Port())
+// NewMainCollector constructor. Sub-collectors missing from enabled fall back to DefaultCollectors.
+func NewMainCollector(client *http.Client, url *url.URL, name string, beatInfo *BeatInfo, enabled map[string]bool, options Options) prometheus.Collector {
+	instance := net.JoinHostPort(url.Hostname(), url.Port())
+	targetLabels := prometheus.Labels{"version": beatInfo.Version, "beat": beatInfo.Beat, "uri": instance}
+	infoLabels := prometheus.Labels{
+		"beat":         beatInfo.Beat,
+		"version":      beatInfo.Version,
+		"hostname":     beatInfo.Hostname,
+		"name":         beatInfo.Name,
+		"ephemeral_id": beatInfo.EphemeralID,
+	}
+	upName := prometheus.BuildFQName("", beatInfo.namespace(), "up")
+	if beatInfo.Naming.UnifiedNamespace {
+		// The registerer adds the beat label, and beat_up is taken by Ping.
+		delete(targetLabels, "beat")
+		delete(infoLabels, "beat")
+		upName = prometheus.BuildFQName("", "beat", "stats_up")
+	}
 	beat := &mainCollector{
 		Collectors: make(map[string]prometheus.Collector),
 		Stats:      &Stats{},
@@ -41,26 +196,101 @@ func NewMainCollector(client *http.Client, url *url.URL, name string, beatInfo *
 			prometheus.BuildFQName(name, "target", "info"),
 			"target information",
 			nil,
-			prometheus.Labels{"version": beatInfo.Version, "beat": beatInfo.Beat, "uri": instance}),
+			targetLabels),
 		targetUp: prometheus.NewDesc(
-			prometheus.BuildFQName("", beatInfo.Beat, "up"),
+			upName,
 			"Target up",
 			nil,
 			nil),
+		infoDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("", "beat", "info"),
+			"Identity of the Beat as of its discovery",
+			nil,
+			infoLabels),
+		retries: prometheus.NewDesc(
+			prometheus.BuildFQName(name, "scrape", "retries_total"),
+			"Number of requests to the stats endpoint retried after a connection failure",
+			nil,
+			nil),
+		tooLarge: prometheus.NewDesc(
+			prometheus.BuildFQName(name, "response_too_large", "total"),
+			"Number of responses of the stats endpoint dropped for exceeding the maximum response size",
+			nil,
+			nil),
+		beatUp: prometheus.NewDesc(
+			prometheus.BuildFQName("", "beat", "up"),
+			"Whether the Beat answered on its root endpoint during the last scrape",
+			nil,
+			nil),
+		infoErrors: prometheus.NewDesc(
+			prometheus.BuildFQName("", "beat", "info_fetch_failures_total"),
+			"Number of failed requests to the root endpoint of the Beat",
+			nil,
+			nil),
+		duration: prometheus.NewDesc(
+			prometheus.BuildFQName(name, "scrape", "duration_seconds"),
+			"Time taken to fetch and decode the stats of the Beat during the last scrape",
+			nil,
+			nil),
+		errorsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(name, "scrape", "errors_total"),
+			"Number of failed scrapes of the Beat by reason",
+			[]string{"reason"},
+			nil),
+		options:      options,
+		scrapeErrors: make(map[string]int),
 
-		beatInfo:   beatInfo,
-		metrics:    exportedMetrics{},
-		systemBeat: systemBeat,
+		beatInfo: beatInfo,
+		metrics:  exportedMetrics{},
+		enabled:  make(map[string]bool),
+	}
+
+	if options.DurationHistogram {
+		beat.histogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: name,
+			Subsystem: "scrape",
+			Name:      "duration_histogram_seconds",
+			Help:      "Histogram of the time taken to fetch and decode the stats of the Beat",
+			Buckets:   prometheus.DefBuckets,
+		})
+	}
+	if options.LatencyHistogram {
+		beat.latency = prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: name,
+			Subsystem: "stats_request",
+			Name:      "duration_seconds",
+			Help:      "Histogram of the time until the Beat answered a request to its stats endpoint",
+			Buckets:   prometheus.DefBuckets,
+		})
+	}
+
+	for name, def := range DefaultCollectors {
+		beat.enabled[name] = def
+		if e, ok := enabled[name]; ok {
+			beat.enabled[name] = e
+		}
 	}
 
 	// Add specific collectors based on the beat type
 	beat.Collectors["system"] = NewSystemCollector(beatInfo, beat.Stats)
-	beat.Collectors["beat"] = NewBeatCollector(beatInfo, beat.Stats)
+	beat.Collectors["runtime"] = NewBeatCollector(beatInfo, beat.Stats)
 	beat.Collectors["libbeat"] = NewLibBeatCollector(beatInfo, beat.Stats)
 	beat.Collectors["registrar"] = NewRegistrarCollector(beatInfo, beat.Stats)
 	beat.Collectors["filebeat"] = NewFilebeatCollector(beatInfo, beat.Stats)
 	beat.Collectors["metricbeat"] = NewMetricbeatCollector(beatInfo, beat.Stats)
 	beat.Collectors["auditd"] = NewAuditdCollector(beatInfo, beat.Stats)
+	beat.Collectors["heartbeat"] = NewHeartbeatCollector(beatInfo, beat.Stats)
+	beat.Collectors["packetbeat"] = NewPacketbeatCollector(beatInfo, beat.Stats)
+	beat.Collectors["winlogbeat"] = NewWinlogbeatCollector(beatInfo, beat.Stats)
+	beat.Collectors["journald"] = NewJournaldCollector(beatInfo, beat.Stats)
+	beat.Collectors["apm-server"] = NewAPMServerCollector(beatInfo, beat.Stats)
+	beat.Collectors["filebeat-inputs"] = NewFilebeatInputsCollector(beatInfo, beat.Stats, options.MaxInputs)
+	beat.Collectors["dataset"] = NewDatasetCollector(beatInfo, beat.Stats)
+	beat.Collectors["filebeat-harvesters"] = NewFilebeatHarvestersCollector(beatInfo, beat.Stats, options)
+
+	if beat.enabled["filebeat-harvesters"] && beatInfo.kind() == "filebeat" && options.RegistryPath == "" {
+		log.Warnf("The filebeat-harvesters collector is enabled for %s without a registry_path, no files will be exported", url)
+	}
 
 	return beat
 }
@@ -69,32 +299,132 @@ func NewMainCollector(client *http.Client, url *url.URL, name string, beatInfo *
 func (b *mainCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- b.targetDesc
 	ch <- b.targetUp
-
-	for _, metric := range b.metrics {
-		ch <- metric.desc
+	ch <- b.infoDesc
+	ch <- b.retries
+	ch <- b.tooLarge
+	ch <- b.duration
+	ch <- b.errorsDesc
+	if b.histogram != nil {
+		b.histogram.Describe(ch)
 	}
-
-	// Describe the standard collectors
-	if b.systemBeat {
-		b.Collectors["system"].Describe(ch)
+	if b.latency != nil {
+		b.latency.Describe(ch)
+	}
+	if b.options.Ping {
+		ch <- b.beatUp
+		ch <- b.infoErrors
 	}
-	b.Collectors["beat"].Describe(ch)
-	b.Collectors["libbeat"].Describe(ch)
-	b.Collectors["auditd"].Describe(ch)
 
-	// Handle custom collectors based on beat type
-	switch b.beatInfo.Beat {
-	case "filebeat":
-		b.Collectors["filebeat"].Describe(ch)
-		b.Collectors["registrar"].Describe(ch)
-	case "metricbeat":
-		b.Collectors["metricbeat"].Describe(ch)
+	b.metrics.describe(ch)
+
+	for _, c := range b.activeCollectors() {
+		c.Describe(ch)
 	}
 }
 
 // Collect returns the current state of all metrics of the collector.
 func (b *mainCollector) Collect(ch chan<- prometheus.Metric) {
-	err := b.fetchStatsEndpoint()
+	b.CollectContext(context.Background(), ch)
+}
+
+// CollectContext implements ContextCollector.
+func (b *mainCollector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	b.collectMu.Lock()
+	defer b.collectMu.Unlock()
+
+	start := time.Now()
+	b.mu.Lock()
+	open := start.Before(b.openUntil)
+	b.mu.Unlock()
+
+	var wg sync.WaitGroup
+	pingErr := errCircuitOpen
+	if b.options.Ping && !open {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pingErr = b.fetchInfo(ctx)
+		}()
+	}
+	err := errCircuitOpen
+	var duration time.Duration
+	if !open {
+		err = b.fetchStatsEndpoint(ctx)
+		duration = time.Since(start)
+	}
+	if err == nil && b.beatInfo.kind() == "filebeat" && b.enabled["filebeat-inputs"] {
+		if inputsErr := b.fetchInputs(ctx); inputsErr != nil {
+			log.Warnf("Failed getting /inputs/ endpoint of %s: %v", b.beatURL, inputsErr)
+		}
+	}
+	var registryErr error
+	if err == nil && b.beatInfo.kind() == "filebeat" && b.enabled["filebeat-harvesters"] && b.options.RegistryPath != "" {
+		if b.Stats.Harvesters, registryErr = readRegistry(b.options.RegistryPath); registryErr != nil {
+			log.Warnf("Failed reading the registry of %s at %s: %v", b.beatURL, b.options.RegistryPath, registryErr)
+		}
+	}
+	if err == nil && b.enabled["dataset"] {
+		if datasetErr := b.fetchDatasets(ctx); datasetErr != nil {
+			log.Warnf("Failed getting /dataset endpoint of %s: %v", b.beatURL, datasetErr)
+		}
+	}
+	wg.Wait()
+
+	b.mu.Lock()
+	if !open && err != nil {
+		b.scrapeErrors[scrapeErrorReason(err)]++
+	}
+	if registryErr != nil {
+		b.scrapeErrors[reasonRegistry]++
+	}
+	if b.options.Ping && !open && pingErr != nil {
+		b.infoFailures++
+	}
+	failures := 0
+	if err != nil {
+		failures = b.lastScrape.Failures + 1
+	}
+	if !open && failures > 0 && b.options.BreakerFailures > 0 && failures >= b.options.BreakerFailures {
+		b.openUntil = time.Now().Add(b.options.BreakerCooldown)
+		log.Warnf("Opening circuit breaker of %s for %s after %d failed scrapes", b.beatURL, b.options.BreakerCooldown, failures)
+	}
+	b.lastScrape = ScrapeStatus{Time: start, Duration: time.Since(start), Err: err, Failures: failures}
+	retries, tooLarge, infoFailures := b.retryCount, b.tooLargeCount, b.infoFailures
+	scrapeErrors := make(map[string]int, len(b.scrapeErrors))
+	for reason, count := range b.scrapeErrors {
+		scrapeErrors[reason] = count
+	}
+	b.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(b.infoDesc, prometheus.GaugeValue, 1)
+	for _, reason := range scrapeErrorReasons {
+		ch <- prometheus.MustNewConstMetric(b.errorsDesc, prometheus.CounterValue, float64(scrapeErrors[reason]), reason)
+	}
+
+	ch <- prometheus.MustNewConstMetric(b.retries, prometheus.CounterValue, float64(retries))
+	ch <- prometheus.MustNewConstMetric(b.tooLarge, prometheus.CounterValue, float64(tooLarge))
+	if !open {
+		ch <- prometheus.MustNewConstMetric(b.duration, prometheus.GaugeValue, duration.Seconds())
+		if b.histogram != nil {
+			b.histogram.Observe(duration.Seconds())
+		}
+	}
+	if b.histogram != nil {
+		b.histogram.Collect(ch)
+	}
+	if b.latency != nil {
+		b.latency.Collect(ch)
+	}
+	if b.options.Ping {
+		up := 0.0
+		if pingErr == nil {
+			up = 1
+		} else {
+			log.Debugf("Ping of %s failed: %v", b.beatURL, pingErr)
+		}
+		ch <- prometheus.MustNewConstMetric(b.beatUp, prometheus.GaugeValue, up)
+		ch <- prometheus.MustNewConstMetric(b.infoErrors, prometheus.CounterValue, float64(infoFailures))
+	}
 	if err != nil {
 		ch <- prometheus.MustNewConstMetric(b.targetUp, prometheus.GaugeValue, float64(0)) // Set target down
 		log.Errorf("Failed getting /stats endpoint of target: " + err.Error())
@@ -104,39 +434,224 @@ func (b *mainCollector) Collect(ch chan<- prometheus.Metric) {
 	ch <- prometheus.MustNewConstMetric(b.targetDesc, prometheus.GaugeValue, float64(1))
 	ch <- prometheus.MustNewConstMetric(b.targetUp, prometheus.GaugeValue, float64(1)) // Set target up
 
-	for _, i := range b.metrics {
-		ch <- prometheus.MustNewConstMetric(i.desc, i.valType, i.eval(b.Stats))
-	}
+	b.metrics.collect(ch, b.Stats)
+	b.collectUnknownFields(ch)
 
-	// Collect metrics from standard collectors
-	if b.systemBeat {
-		b.Collectors["system"].Collect(ch)
+	for _, c := range b.activeCollectors() {
+		c.Collect(ch)
 	}
-	b.Collectors["beat"].Collect(ch)
-	b.Collectors["libbeat"].Collect(ch)
-	b.Collectors["auditd"].Collect(ch)
+}
+
+// LastScrape implements StatusReporter.
+func (b *mainCollector) LastScrape() ScrapeStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastScrape
+}
 
-	// Handle custom collectors per beat type
-	switch b.beatInfo.Beat {
+// activeCollectors returns the enabled sub-collectors that apply to the beat type.
+func (b *mainCollector) activeCollectors() []prometheus.Collector {
+	names := []string{"system", "runtime", "libbeat", "auditd", "dataset"}
+
+	// Handle custom collectors based on beat type
+	switch b.beatInfo.kind() {
 	case "filebeat":
-		b.Collectors["filebeat"].Collect(ch)
-		b.Collectors["registrar"].Collect(ch)
+		names = append(names, "filebeat", "registrar", "journald", "filebeat-inputs", "filebeat-harvesters")
 	case "metricbeat":
-		b.Collectors["metricbeat"].Collect(ch)
+		names = append(names, "metricbeat")
+	case "heartbeat":
+		names = append(names, "heartbeat")
+	case "packetbeat":
+		names = append(names, "packetbeat")
+	case "journalbeat":
+		names = append(names, "journald")
+	case "apm-server":
+		names = append(names, "apm-server")
+	case "winlogbeat":
+		names = append(names, "winlogbeat")
+	}
+
+	var collectors []prometheus.Collector
+	for _, name := range names {
+		if b.enabled[name] {
+			collectors = append(collectors, b.Collectors[name])
+		}
+	}
+	return collectors
+}
+
+// getWithRetries sends a GET request to the Beat, retrying requests that fail
+// to get a response with exponential backoff until ctx is done.
+func (b *mainCollector) getWithRetries(ctx context.Context, url string) (*http.Response, error) {
+	backoff := b.options.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		response, err := b.client.Do(request)
+		if err == nil && b.latency != nil {
+			observe(ctx, b.latency, time.Since(start).Seconds())
+		}
+		if err == nil || attempt >= b.options.Retries || ctx.Err() != nil {
+			return response, err
+		}
+
+		delay := backoff + time.Duration(rand.Float64()*b.options.RetryJitter*float64(backoff))
+		log.Debugf("GET %s failed, retrying in %s: %v", url, delay, err)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+		backoff *= 2
+
+		b.mu.Lock()
+		b.retryCount++
+		b.mu.Unlock()
+	}
+}
+
+// Endpoint returns the URL of the Beat API endpoint at path, joined to the
+// path prefix of the Beat URL if its API is served under one, e.g. by a
+// reverse proxy.
+func Endpoint(beatURL *url.URL, path string) string {
+	u := *beatURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawPath = ""
+	return u.String()
+}
+
+// ErrResponseTooLarge is returned by ReadBody for responses above the limit.
+var ErrResponseTooLarge = errors.New("response too large")
+
+// ReadBody reads the body of a response of a Beat, failing with
+// ErrResponseTooLarge once more than limit bytes are read, if limit is not 0,
+// so that a misbehaving endpoint can't exhaust the memory of the exporter.
+func ReadBody(response *http.Response, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return ioutil.ReadAll(response.Body)
+	}
+	// Read a byte past the limit to tell a body of exactly limit bytes from
+	// a larger one.
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrResponseTooLarge, limit)
+	}
+	return body, nil
+}
+
+// getJSON requests the endpoint of the Beat at path and decodes its JSON
+// response into v, within the timeout of the client.
+func (b *mainCollector) getJSON(ctx context.Context, path string, v interface{}) error {
+	if b.client.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.client.Timeout)
+		defer cancel()
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, Endpoint(b.beatURL, path), nil)
+	if err != nil {
+		return err
+	}
+	response, err := b.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return statusError{code: response.StatusCode}
+	}
+
+	bodyBytes, err := ReadBody(response, b.options.MaxResponseBytes)
+	if err != nil {
+		return err
 	}
+	if err := json.Unmarshal(bodyBytes, v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// fetchInfo requests the root endpoint of the Beat and checks that it answers
+// with its info.
+func (b *mainCollector) fetchInfo(ctx context.Context) error {
+	var info BeatInfo
+	if err := b.getJSON(ctx, "/", &info); err != nil {
+		return err
+	}
+	if info.Beat == "" {
+		return errors.New("response is missing the beat name")
+	}
+	return nil
+}
+
+// fetchInputs requests the /inputs/ endpoint of Filebeat into Stats.Inputs,
+// sorted by ID, keeping the first of inputs listed more than once.
+// Stats.Inputs is emptied if the request fails.
+func (b *mainCollector) fetchInputs(ctx context.Context) error {
+	b.Stats.Inputs = nil
+	var inputs []FilebeatInput
+	if err := b.getJSON(ctx, "/inputs/", &inputs); err != nil {
+		return err
+	}
+	sort.SliceStable(inputs, func(i, j int) bool { return inputs[i].ID < inputs[j].ID })
+	for i, input := range inputs {
+		if i > 0 && input.ID == inputs[i-1].ID {
+			log.Debugf("Skipping input %s of %s, listed more than once", input.ID, b.beatURL)
+			continue
+		}
+		b.Stats.Inputs = append(b.Stats.Inputs, input)
+	}
+	return nil
+}
+
+// fetchDatasets requests the /dataset endpoint of the Beat into
+// Stats.Datasets. Stats.Datasets is emptied if the request fails.
+func (b *mainCollector) fetchDatasets(ctx context.Context) error {
+	b.Stats.Datasets = nil
+	var datasets map[string]interface{}
+	if err := b.getJSON(ctx, "/dataset", &datasets); err != nil {
+		return err
+	}
+	b.Stats.Datasets = datasetFields(datasets)
+	return nil
 }
 
 // fetchStatsEndpoint fetches the stats endpoint for the Beat.
-func (b *mainCollector) fetchStatsEndpoint() error {
-	response, err := b.client.Get(b.beatURL.String() + "/stats")
+func (b *mainCollector) fetchStatsEndpoint(ctx context.Context) error {
+	start := time.Now()
+	if b.options.Reconnect {
+		b.client.CloseIdleConnections()
+	}
+	if b.client.Timeout > 0 {
+		// Retries share the timeout of the client.
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.client.Timeout)
+		defer cancel()
+	}
+	statsURL := Endpoint(b.beatURL, "/stats")
+	response, err := b.getWithRetries(ctx, statsURL)
 	if err != nil {
 		log.Errorf("Could not fetch stats endpoint of target: %v", b.beatURL.String())
 		return err
 	}
 	defer response.Body.Close()
+	log.Debugf("GET %s returned %d in %s", statsURL, response.StatusCode, time.Since(start))
+	if response.StatusCode != http.StatusOK {
+		return statusError{code: response.StatusCode}
+	}
 
-	bodyBytes, err := ioutil.ReadAll(response.Body)
+	bodyBytes, err := ReadBody(response, b.options.MaxResponseBytes)
 	if err != nil {
+		if errors.Is(err, ErrResponseTooLarge) {
+			b.mu.Lock()
+			b.tooLargeCount++
+			b.mu.Unlock()
+		}
 		log.Error("Can't read body of response")
 		return err
 	}
@@ -144,11 +659,34 @@ func (b *mainCollector) fetchStatsEndpoint() error {
 	// Apply a regex fix specifically for Filebeat
 	bodyBytes = HackfixRegex.ReplaceAll(bodyBytes, []byte("\"time\":{\"ms\":$1}"))
 
+	if b.options.UnknownFields {
+		if b.unknown, err = unknownFields(bodyBytes); err != nil {
+			log.Error("Could not parse JSON response for target")
+			return decodeError{err: err}
+		}
+	}
+
 	err = json.Unmarshal(bodyBytes, &b.Stats)
 	if err != nil {
 		log.Error("Could not parse JSON response for target")
-		return err
+		return decodeError{err: err}
 	}
 
 	return nil
 }
+
+// collectUnknownFields sends the fields of the last stats that no collector
+// covers, skipping those whose name another field already took.
+func (b *mainCollector) collectUnknownFields(ch chan<- prometheus.Metric) {
+	seen := make(map[string]bool, len(b.unknown))
+	for _, field := range b.unknown {
+		name := unknownFieldName(b.beatInfo.namespace(), field.path)
+		if seen[name] {
+			log.Debugf("Skipping stats field %s of %s, named %s like another field", field.path, b.beatURL, name)
+			continue
+		}
+		seen[name] = true
+		desc := prometheus.NewDesc(name, "Stats field "+field.path+" of the Beat", nil, nil)
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.UntypedValue, field.value)
+	}
+}
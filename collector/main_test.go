@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestReadBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		limit   int64
+		wantErr error
+	}{
+		{"no limit", "0123456789", 0, nil},
+		{"below limit", "012345678", 10, nil},
+		{"at limit", "0123456789", 10, nil},
+		{"above limit", "0123456789a", 10, ErrResponseTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := &http.Response{Body: ioutil.NopCloser(strings.NewReader(test.body))}
+			body, err := ReadBody(response, test.limit)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("err = %v, want %v", err, test.wantErr)
+			}
+			if err == nil && string(body) != test.body {
+				t.Errorf("body = %q, want %q", body, test.body)
+			}
+		})
+	}
+}
+
+func TestContextWithTraceParent(t *testing.T) {
+	tests := map[string]string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":     "4bf92f3577b34da6a3ce929d0e0e4736",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-03":     "4bf92f3577b34da6a3ce929d0e0e4736",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-abc": "4bf92f3577b34da6a3ce929d0e0e4736",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00":     "",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01":     "",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-abc": "",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":     "",
+		"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01":     "",
+		"": "",
+	}
+	for header, want := range tests {
+		got, _ := sampledTraceID(ContextWithTraceParent(context.Background(), header))
+		if got != want {
+			t.Errorf("trace ID of %q = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestObserveExemplar(t *testing.T) {
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_seconds", Buckets: []float64{1}})
+	observe(context.Background(), histogram, 0.5)
+	ctx := ContextWithTraceParent(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	observe(ctx, histogram, 0.25)
+
+	var metric dto.Metric
+	if err := histogram.Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	if count := metric.GetHistogram().GetSampleCount(); count != 2 {
+		t.Errorf("sample count = %d, want 2", count)
+	}
+	exemplar := metric.GetHistogram().GetBucket()[0].GetExemplar()
+	if exemplar.GetValue() != 0.25 || len(exemplar.GetLabel()) != 1 || exemplar.GetLabel()[0].GetValue() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("exemplar = %v, want the observation of the sampled trace", exemplar)
+	}
+}
+
+func TestRegistryScrapeError(t *testing.T) {
+	stats, err := ioutil.ReadFile("testdata/stats.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(stats)
+	}))
+	defer server.Close()
+	beatURL, _ := url.Parse(server.URL)
+
+	beatInfo := &BeatInfo{Beat: "filebeat", Version: "8.12.0"}
+	options := Options{RegistryPath: "testdata/registry/broken-checkpoint"}
+	c := NewMainCollector(server.Client(), beatURL, "beat_exporter", beatInfo, map[string]bool{"filebeat-harvesters": true}, options)
+	ch := make(chan prometheus.Metric, 10000)
+	c.Collect(ch)
+	close(ch)
+
+	counts := map[string]float64{}
+	for metric := range ch {
+		if !strings.Contains(metric.Desc().String(), `"beat_exporter_scrape_errors_total"`) {
+			continue
+		}
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		counts[m.GetLabel()[0].GetValue()] = m.GetCounter().GetValue()
+	}
+	for _, reason := range scrapeErrorReasons {
+		want := 0.0
+		if reason == reasonRegistry {
+			want = 1
+		}
+		if counts[reason] != want {
+			t.Errorf("scrape errors with reason %s = %v, want %v", reason, counts[reason], want)
+		}
+	}
+}
@@ -1,13 +1,20 @@
 package collector
 
 import (
+	"encoding/json"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 //MetricbeatEvent json structure
 type MetricbeatEvent struct {
-	Failures float64 `json:"failures"`
-	Success  float64 `json:"success"`
+	Events              float64 `json:"events"`
+	Failures            float64 `json:"failures"`
+	Success             float64 `json:"success"`
+	ConsecutiveFailures float64 `json:"consecutive_failures"`
+	FetchDuration       struct {
+		MS float64 `json:"ms"`
+	} `json:"fetch_duration"`
 }
 
 //Metricbeat json structure
@@ -23,12 +30,64 @@ type Metricbeat struct {
 		ProcessSummary MetricbeatEvent `json:"process_summary"`
 		Uptime         MetricbeatEvent `json:"uptime"`
 	} `json:"system"`
+
+	// Modules holds the stats of every metricset, by module and metricset
+	// name.
+	Modules map[string]map[string]MetricbeatEvent `json:"-"`
+}
+
+// UnmarshalJSON decodes the metricbeat section, collecting every
+// metricset into Modules. Entries that aren't metricsets are skipped.
+func (m *Metricbeat) UnmarshalJSON(data []byte) error {
+	type plain Metricbeat
+	if err := json.Unmarshal(data, (*plain)(m)); err != nil {
+		return err
+	}
+
+	m.Modules = map[string]map[string]MetricbeatEvent{}
+	var modules map[string]json.RawMessage
+	if err := json.Unmarshal(data, &modules); err != nil {
+		return err
+	}
+	for module, raw := range modules {
+		var metricsets map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &metricsets); err != nil {
+			continue
+		}
+		for metricset, raw := range metricsets {
+			var event MetricbeatEvent
+			if err := json.Unmarshal(raw, &event); err != nil {
+				continue
+			}
+			if m.Modules[module] == nil {
+				m.Modules[module] = map[string]MetricbeatEvent{}
+			}
+			m.Modules[module][metricset] = event
+		}
+	}
+	return nil
 }
 
 type metricbeatCollector struct {
-	beatInfo *BeatInfo
-	stats    *Stats
-	metrics  exportedMetrics
+	beatInfo   *BeatInfo
+	stats      *Stats
+	metrics    exportedMetrics
+	metricsets labelledMetrics
+	failing    *prometheus.Desc
+	total      *prometheus.Desc
+}
+
+// metricsetValue adapts eval to the entries of labelledMetric, the
+// metricsets.
+func metricsetValue(eval func(event MetricbeatEvent) float64) func(entry interface{}) *float64 {
+	return func(entry interface{}) *float64 {
+		value := eval(entry.(MetricbeatEvent))
+		return &value
+	}
+}
+
+func newMetricsetMetric(beatInfo *BeatInfo, name, help string, eval func(event MetricbeatEvent) float64, valType prometheus.ValueType) labelledMetric {
+	return newLabelledMetric(beatInfo, "metricbeat_metricset", name, help, []string{"module", "metricset"}, metricsetValue(eval), valType)
 }
 
 // NewMetricbeatCollector constructor
@@ -36,10 +95,32 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 	return &metricbeatCollector{
 		beatInfo: beatInfo,
 		stats:    stats,
+		metricsets: labelledMetrics{
+			newMetricsetMetric(beatInfo, "events_total", "Events published by the metricset.",
+				func(event MetricbeatEvent) float64 { return event.Events }, beatInfo.cumulativeValueType()),
+			newMetricsetMetric(beatInfo, "success_total", "Successful fetches of the metricset.",
+				func(event MetricbeatEvent) float64 { return event.Success }, beatInfo.cumulativeValueType()),
+			newMetricsetMetric(beatInfo, "failures_total", "Failed fetches of the metricset.",
+				func(event MetricbeatEvent) float64 { return event.Failures }, beatInfo.cumulativeValueType()),
+			newMetricsetMetric(beatInfo, "consecutive_failures", "Failed fetches of the metricset since its last successful one.",
+				func(event MetricbeatEvent) float64 { return event.ConsecutiveFailures }, prometheus.GaugeValue),
+			newMetricsetMetric(beatInfo, "fetch_duration_seconds", "Duration of the last fetch of the metricset.",
+				func(event MetricbeatEvent) float64 { return event.FetchDuration.MS / 1000 }, prometheus.GaugeValue),
+		},
+		failing: prometheus.NewDesc(
+			prometheus.BuildFQName(beatInfo.namespace(), "metricbeat", "metricsets_failing"),
+			"Number of metricsets whose last fetch failed.",
+			nil, nil,
+		),
+		total: prometheus.NewDesc(
+			prometheus.BuildFQName(beatInfo.namespace(), "metricbeat", "metricsets"),
+			"Number of metricsets reported by the Beat.",
+			nil, nil,
+		),
 		metrics: exportedMetrics{
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "metricbeat_system", "cpu"),
+					prometheus.BuildFQName(beatInfo.namespace(), "metricbeat_system", "cpu"),
 					"system.cpu",
 					nil, prometheus.Labels{"event": "success"},
 				),
@@ -48,7 +129,7 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "metricbeat_system", "cpu"),
+					prometheus.BuildFQName(beatInfo.namespace(), "metricbeat_system", "cpu"),
 					"system.cpu",
 					nil, prometheus.Labels{"event": "failures"},
 				),
@@ -57,7 +138,7 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "metricbeat_system", "filesystem"),
+					prometheus.BuildFQName(beatInfo.namespace(), "metricbeat_system", "filesystem"),
 					"system.filesystem",
 					nil, prometheus.Labels{"event": "success"},
 				),
@@ -66,7 +147,7 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "metricbeat_system", "filesystem"),
+					prometheus.BuildFQName(beatInfo.namespace(), "metricbeat_system", "filesystem"),
 					"system.filesystem",
 					nil, prometheus.Labels{"event": "failures"},
 				),
@@ -75,7 +156,7 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "metricbeat_system", "fsstat"),
+					prometheus.BuildFQName(beatInfo.namespace(), "metricbeat_system", "fsstat"),
 					"system.fsstat",
 					nil, prometheus.Labels{"event": "success"},
 				),
@@ -84,7 +165,7 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "metricbeat_system", "fsstat"),
+					prometheus.BuildFQName(beatInfo.namespace(), "metricbeat_system", "fsstat"),
 					"system.fsstat",
 					nil, prometheus.Labels{"event": "failures"},
 				),
@@ -93,7 +174,7 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "metricbeat_system", "load"),
+					prometheus.BuildFQName(beatInfo.namespace(), "metricbeat_system", "load"),
 					"system.load",
 					nil, prometheus.Labels{"event": "success"},
 				),
@@ -102,7 +183,7 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "metricbeat_system", "load"),
+					prometheus.BuildFQName(beatInfo.namespace(), "metricbeat_system", "load"),
 					"system.load",
 					nil, prometheus.Labels{"event": "failures"},
 				),
@@ -111,7 +192,7 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "metricbeat_system", "memory"),
+					prometheus.BuildFQName(beatInfo.namespace(), "metricbeat_system", "memory"),
 					"system.memory",
 					nil, prometheus.Labels{"event": "success"},
 				),
@@ -120,7 +201,7 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "metricbeat_system", "memory"),
+					prometheus.BuildFQName(beatInfo.namespace(), "metricbeat_system", "memory"),
 					"system.memory",
 					nil, prometheus.Labels{"event": "failures"},
 				),
@@ -129,7 +210,7 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "metricbeat_system", "network"),
+					prometheus.BuildFQName(beatInfo.namespace(), "metricbeat_system", "network"),
 					"system.network",
 					nil, prometheus.Labels{"event": "success"},
 				),
@@ -138,7 +219,7 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "metricbeat_system", "network"),
+					prometheus.BuildFQName(beatInfo.namespace(), "metricbeat_system", "network"),
 					"system.network",
 					nil, prometheus.Labels{"event": "failures"},
 				),
@@ -147,7 +228,7 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "metricbeat_system", "process"),
+					prometheus.BuildFQName(beatInfo.namespace(), "metricbeat_system", "process"),
 					"system.process",
 					nil, prometheus.Labels{"event": "success"},
 				),
@@ -156,7 +237,7 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "metricbeat_system", "process"),
+					prometheus.BuildFQName(beatInfo.namespace(), "metricbeat_system", "process"),
 					"system.process",
 					nil, prometheus.Labels{"event": "failures"},
 				),
@@ -165,7 +246,7 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "metricbeat_system", "process_summary"),
+					prometheus.BuildFQName(beatInfo.namespace(), "metricbeat_system", "process_summary"),
 					"system.process_summary",
 					nil, prometheus.Labels{"event": "success"},
 				),
@@ -174,7 +255,7 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "metricbeat_system", "process_summary"),
+					prometheus.BuildFQName(beatInfo.namespace(), "metricbeat_system", "process_summary"),
 					"system.process_summary",
 					nil, prometheus.Labels{"event": "failures"},
 				),
@@ -183,7 +264,7 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "metricbeat_system", "uptime"),
+					prometheus.BuildFQName(beatInfo.namespace(), "metricbeat_system", "uptime"),
 					"system.uptime",
 					nil, prometheus.Labels{"event": "success"},
 				),
@@ -192,7 +273,7 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "metricbeat_system", "uptime"),
+					prometheus.BuildFQName(beatInfo.namespace(), "metricbeat_system", "uptime"),
 					"system.uptime",
 					nil, prometheus.Labels{"event": "failures"},
 				),
@@ -206,17 +287,30 @@ func NewMetricbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collect
 // Describe returns all descriptions of the collector.
 func (c *metricbeatCollector) Describe(ch chan<- *prometheus.Desc) {
 
-	for _, metric := range c.metrics {
-		ch <- metric.desc
-	}
+	c.metrics.describe(ch)
+
+	c.metricsets.describe(ch)
+	ch <- c.failing
+	ch <- c.total
 
 }
 
 // Collect returns the current state of all metrics of the collector.
 func (c *metricbeatCollector) Collect(ch chan<- prometheus.Metric) {
 
-	for _, i := range c.metrics {
-		ch <- prometheus.MustNewConstMetric(i.desc, i.valType, i.eval(c.stats))
+	c.metrics.collect(ch, c.stats)
+
+	failing, total := 0, 0
+	for module, metricsets := range c.stats.Metricbeat.Modules {
+		for metricset, event := range metricsets {
+			c.metricsets.collect(ch, event, module, metricset)
+			if event.ConsecutiveFailures > 0 {
+				failing++
+			}
+			total++
+		}
 	}
+	ch <- prometheus.MustNewConstMetric(c.failing, prometheus.GaugeValue, float64(failing))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(total))
 
 }
@@ -0,0 +1,136 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PacketbeatProtocol json structure of the stats of one protocol
+type PacketbeatProtocol struct {
+	Transactions float64 `json:"transactions"`
+}
+
+// Packetbeat json structure
+type Packetbeat struct {
+	Flows struct {
+		Active float64 `json:"active"`
+		New    float64 `json:"new"`
+		Closed float64 `json:"closed"`
+	} `json:"flows"`
+	Packets struct {
+		Dropped float64 `json:"dropped"`
+	} `json:"packets"`
+	AMQP      PacketbeatProtocol `json:"amqp"`
+	Cassandra PacketbeatProtocol `json:"cassandra"`
+	DHCPv4    PacketbeatProtocol `json:"dhcpv4"`
+	DNS       PacketbeatProtocol `json:"dns"`
+	HTTP      PacketbeatProtocol `json:"http"`
+	ICMP      PacketbeatProtocol `json:"icmp"`
+	Memcache  PacketbeatProtocol `json:"memcache"`
+	MongoDB   PacketbeatProtocol `json:"mongodb"`
+	MySQL     PacketbeatProtocol `json:"mysql"`
+	NFS       PacketbeatProtocol `json:"nfs"`
+	PgSQL     PacketbeatProtocol `json:"pgsql"`
+	Redis     PacketbeatProtocol `json:"redis"`
+	SIP       PacketbeatProtocol `json:"sip"`
+	Thrift    PacketbeatProtocol `json:"thrift"`
+	TLS       PacketbeatProtocol `json:"tls"`
+}
+
+// packetbeatProtocols lists the protocols whose transactions are exported,
+// by the name Packetbeat reports them under.
+var packetbeatProtocols = []struct {
+	name  string
+	stats func(p *Packetbeat) *PacketbeatProtocol
+}{
+	{"amqp", func(p *Packetbeat) *PacketbeatProtocol { return &p.AMQP }},
+	{"cassandra", func(p *Packetbeat) *PacketbeatProtocol { return &p.Cassandra }},
+	{"dhcpv4", func(p *Packetbeat) *PacketbeatProtocol { return &p.DHCPv4 }},
+	{"dns", func(p *Packetbeat) *PacketbeatProtocol { return &p.DNS }},
+	{"http", func(p *Packetbeat) *PacketbeatProtocol { return &p.HTTP }},
+	{"icmp", func(p *Packetbeat) *PacketbeatProtocol { return &p.ICMP }},
+	{"memcache", func(p *Packetbeat) *PacketbeatProtocol { return &p.Memcache }},
+	{"mongodb", func(p *Packetbeat) *PacketbeatProtocol { return &p.MongoDB }},
+	{"mysql", func(p *Packetbeat) *PacketbeatProtocol { return &p.MySQL }},
+	{"nfs", func(p *Packetbeat) *PacketbeatProtocol { return &p.NFS }},
+	{"pgsql", func(p *Packetbeat) *PacketbeatProtocol { return &p.PgSQL }},
+	{"redis", func(p *Packetbeat) *PacketbeatProtocol { return &p.Redis }},
+	{"sip", func(p *Packetbeat) *PacketbeatProtocol { return &p.SIP }},
+	{"thrift", func(p *Packetbeat) *PacketbeatProtocol { return &p.Thrift }},
+	{"tls", func(p *Packetbeat) *PacketbeatProtocol { return &p.TLS }},
+}
+
+type packetbeatCollector struct {
+	beatInfo *BeatInfo
+	stats    *Stats
+	metrics  exportedMetrics
+}
+
+// NewPacketbeatCollector constructor
+func NewPacketbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
+	c := &packetbeatCollector{
+		beatInfo: beatInfo,
+		stats:    stats,
+		metrics: exportedMetrics{
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "flows", "active"),
+					"Number of flows being tracked",
+					nil, nil,
+				),
+				eval:    func(stats *Stats) float64 { return stats.Packetbeat.Flows.Active },
+				valType: prometheus.GaugeValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "flows", "new_total"),
+					"Number of flows started",
+					nil, nil,
+				),
+				eval:    func(stats *Stats) float64 { return stats.Packetbeat.Flows.New },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "flows", "closed_total"),
+					"Number of flows closed",
+					nil, nil,
+				),
+				eval:    func(stats *Stats) float64 { return stats.Packetbeat.Flows.Closed },
+				valType: prometheus.CounterValue,
+			},
+			{
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(beatInfo.namespace(), "packets", "dropped_total"),
+					"Number of captured packets dropped",
+					nil, nil,
+				),
+				eval:    func(stats *Stats) float64 { return stats.Packetbeat.Packets.Dropped },
+				valType: prometheus.CounterValue,
+			},
+		},
+	}
+
+	for _, protocol := range packetbeatProtocols {
+		stats := protocol.stats
+		c.metrics = append(c.metrics, exportedMetric{
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName(beatInfo.namespace(), "protocol", "transactions_total"),
+				"Number of transactions published by protocol",
+				nil, prometheus.Labels{"protocol": protocol.name},
+			),
+			eval:    func(s *Stats) float64 { return stats(&s.Packetbeat).Transactions },
+			valType: prometheus.CounterValue,
+		})
+	}
+	return c
+}
+
+// Describe returns all descriptions of the collector.
+func (c *packetbeatCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.metrics.describe(ch)
+}
+
+// Collect returns the current state of all metrics of the collector.
+func (c *packetbeatCollector) Collect(ch chan<- prometheus.Metric) {
+	c.metrics.collect(ch, c.stats)
+}
@@ -32,34 +32,34 @@ func NewRegistrarCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collecto
 		metrics: exportedMetrics{
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "registrar", "writes"),
+					prometheus.BuildFQName(beatInfo.namespace(), "registrar", "writes"),
 					"registrar.writes",
 					nil, prometheus.Labels{"writes": "fail"},
 				),
 				eval:    func(stats *Stats) float64 { return stats.Registrar.Writes.Fail },
-				valType: prometheus.GaugeValue,
+				valType: beatInfo.cumulativeValueType(),
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "registrar", "writes"),
+					prometheus.BuildFQName(beatInfo.namespace(), "registrar", "writes"),
 					"registrar.writes",
 					nil, prometheus.Labels{"writes": "success"},
 				),
 				eval:    func(stats *Stats) float64 { return stats.Registrar.Writes.Success },
-				valType: prometheus.GaugeValue,
+				valType: beatInfo.cumulativeValueType(),
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "registrar", "writes"),
+					prometheus.BuildFQName(beatInfo.namespace(), "registrar", "writes"),
 					"registrar.writes",
 					nil, prometheus.Labels{"writes": "total"},
 				),
 				eval:    func(stats *Stats) float64 { return stats.Registrar.Writes.Total },
-				valType: prometheus.GaugeValue,
+				valType: beatInfo.cumulativeValueType(),
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "registrar", "states"),
+					prometheus.BuildFQName(beatInfo.namespace(), "registrar", "states"),
 					"registrar.states",
 					nil, prometheus.Labels{"state": "cleanup"},
 				),
@@ -68,7 +68,7 @@ func NewRegistrarCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collecto
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "registrar", "states"),
+					prometheus.BuildFQName(beatInfo.namespace(), "registrar", "states"),
 					"registrar.states",
 					nil, prometheus.Labels{"state": "current"},
 				),
@@ -77,7 +77,7 @@ func NewRegistrarCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collecto
 			},
 			{
 				desc: prometheus.NewDesc(
-					prometheus.BuildFQName(beatInfo.Beat, "registrar", "states"),
+					prometheus.BuildFQName(beatInfo.namespace(), "registrar", "states"),
 					"registrar.states",
 					nil, prometheus.Labels{"state": "update"},
 				),
@@ -91,17 +91,13 @@ func NewRegistrarCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collecto
 // Describe returns all descriptions of the collector.
 func (c *registrarCollector) Describe(ch chan<- *prometheus.Desc) {
 
-	for _, metric := range c.metrics {
-		ch <- metric.desc
-	}
+	c.metrics.describe(ch)
 
 }
 
 // Collect returns the current state of all metrics of the collector.
 func (c *registrarCollector) Collect(ch chan<- prometheus.Metric) {
 
-	for _, i := range c.metrics {
-		ch <- prometheus.MustNewConstMetric(i.desc, i.valType, i.eval(c.stats))
-	}
+	c.metrics.collect(ch, c.stats)
 
 }
@@ -1,31 +1,188 @@
 package collector
 
 import (
+	"strings"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 //BeatInfo beat info json structure
 type BeatInfo struct {
-	Beat     string `json:"beat"`
-	Hostname string `json:"hostname"`
-	Name     string `json:"name"`
-	UUID     string `json:"uuid"`
-	Version  string `json:"version"`
+	Beat        string `json:"beat"`
+	Hostname    string `json:"hostname"`
+	Name        string `json:"name"`
+	UUID        string `json:"uuid"`
+	Version     string `json:"version"`
+	EphemeralID string `json:"ephemeral_id"`
+
+	// Type and Namespace, if set, override the Beat name as the type whose
+	// collectors apply and as the prefix of the metric names, for custom
+	// Beats.
+	Type      string `json:"-"`
+	Namespace string `json:"-"`
+	// Naming is copied from Options.Naming when the Beat is discovered.
+	Naming Naming `json:"-"`
 }
 
 //Stats stats endpoint json structure
 type Stats struct {
-	System     System      `json:"system"`
-	Beat       BeatStats   `json:"beat"`
-	LibBeat    LibBeat     `json:"libbeat"`
-	Registrar  Registrar   `json:"registrar"`
-	Filebeat   Filebeat    `json:"filebeat"`
-	Metricbeat Metricbeat  `json:"metricbeat"`
-	Auditd     AuditdStats `json:"auditd"`
+	System      System      `json:"system"`
+	Beat        BeatStats   `json:"beat"`
+	LibBeat     LibBeat     `json:"libbeat"`
+	Registrar   Registrar   `json:"registrar"`
+	Filebeat    Filebeat    `json:"filebeat"`
+	Metricbeat  Metricbeat  `json:"metricbeat"`
+	Auditd      AuditdStats `json:"auditd"`
+	Heartbeat   Heartbeat   `json:"heartbeat"`
+	Packetbeat  Packetbeat  `json:"packetbeat"`
+	Journalbeat Journald    `json:"journalbeat"`
+	APMServer   APMServer   `json:"apm-server"`
+	Winlogbeat  Winlogbeat  `json:"winlogbeat"`
+
+	// Inputs holds the stats of the inputs of Filebeat, fetched from its
+	// /inputs/ endpoint by the filebeat-inputs collector.
+	Inputs []FilebeatInput `json:"-"`
+	// Datasets holds the fields of the datasets of the Beat, fetched from
+	// its /dataset endpoint by the dataset collector.
+	Datasets []DatasetField `json:"-"`
+	// Harvesters holds the files of Filebeat, read from its registry by
+	// the filebeat-harvesters collector.
+	Harvesters []Harvester `json:"-"`
+}
+
+// Naming selects the names and types under which the stats of a Beat are
+// exported.
+type Naming struct {
+	// UnifiedNamespace names the metrics of every Beat type beat_* instead
+	// of after the type, e.g. beat_events_active instead of
+	// filebeat_events_active. The type is then told by a beat label, which
+	// the registerer of the collectors has to add.
+	UnifiedNamespace bool
+	// CleanNames drops the labels that repeat the name of the metric they
+	// are on, together with the repeated subsystem in that name, e.g.
+	// exporting filebeat_events_active instead of
+	// filebeat_events_events_active{event="active"}.
+	CleanNames bool
+	// LegacyNames exports the series this exporter renamed or labelled
+	// apart from the original trustpilot/beat-exporter as the original did,
+	// e.g. filebeat_filebeat_events{event="active"} instead of
+	// filebeat_events_events_active{event="active"}, and libbeat output
+	// metrics without the output label. It implies LegacyTypes.
+	LegacyNames bool
+	// LegacyTypes keeps exporting the stats that only ever increase, such
+	// as events added or registrar writes, as gauges, and the other series
+	// whose types changed with the types of earlier versions.
+	LegacyTypes bool
+	// DerivedMetrics exports metrics computed from several stats, such as
+	// the average size of the batches sent by the output.
+	DerivedMetrics bool
+}
+
+// legacyTypes reports whether stats are exported with the types of earlier
+// versions.
+func (b *BeatInfo) legacyTypes() bool {
+	return b.Naming.LegacyNames || b.Naming.LegacyTypes
 }
 
-type exportedMetrics []struct {
+// cumulativeValueType returns the type of the stats that only ever
+// increase, counter unless exported with legacy types.
+func (b *BeatInfo) cumulativeValueType() prometheus.ValueType {
+	if b.legacyTypes() {
+		return prometheus.GaugeValue
+	}
+	return prometheus.CounterValue
+}
+
+// namespace returns the prefix of the names of the Beat's metrics, the Beat
+// type with dashes, as in apm-server, replaced by underscores.
+func (b *BeatInfo) namespace() string {
+	if b.Naming.UnifiedNamespace {
+		return "beat"
+	}
+	if b.Namespace != "" {
+		return b.Namespace
+	}
+	return strings.Replace(b.Beat, "-", "_", -1)
+}
+
+// kind returns the type of the Beat, which selects its collectors.
+func (b *BeatInfo) kind() string {
+	if b.Type != "" {
+		return b.Type
+	}
+	return b.Beat
+}
+
+// exportedMetric is a metric with the function extracting its value from
+// the stats of the Beat.
+type exportedMetric struct {
 	desc    *prometheus.Desc
 	eval    func(stats *Stats) float64
 	valType prometheus.ValueType
+	// labels returns the values of the variable labels of desc, if it has
+	// any.
+	labels func(stats *Stats) []string
+}
+
+// exportedMetrics is the table of the metrics of a collector.
+type exportedMetrics []exportedMetric
+
+// describe sends the descriptors of the metrics to ch.
+func (m exportedMetrics) describe(ch chan<- *prometheus.Desc) {
+	for _, metric := range m {
+		ch <- metric.desc
+	}
+}
+
+// collect sends the values of the metrics in stats to ch.
+func (m exportedMetrics) collect(ch chan<- prometheus.Metric, stats *Stats) {
+	for _, metric := range m {
+		var labels []string
+		if metric.labels != nil {
+			labels = metric.labels(stats)
+		}
+		ch <- prometheus.MustNewConstMetric(metric.desc, metric.valType, metric.eval(stats), labels...)
+	}
+}
+
+// labelledMetric is a metric exported for every entry of a section of the
+// stats, e.g. every input or processor, labelled to tell the entries apart.
+type labelledMetric struct {
+	desc    *prometheus.Desc
+	valType prometheus.ValueType
+	// eval returns the value of the metric for an entry, or nil if the
+	// entry doesn't report it.
+	eval func(entry interface{}) *float64
+}
+
+func newLabelledMetric(beatInfo *BeatInfo, subsystem, name, help string, labels []string, eval func(entry interface{}) *float64, valType prometheus.ValueType) labelledMetric {
+	return labelledMetric{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(beatInfo.namespace(), subsystem, name),
+			help,
+			labels, nil,
+		),
+		eval:    eval,
+		valType: valType,
+	}
+}
+
+// labelledMetrics is the table of the metrics of the entries of a section.
+type labelledMetrics []labelledMetric
+
+// describe sends the descriptors of the metrics to ch.
+func (m labelledMetrics) describe(ch chan<- *prometheus.Desc) {
+	for _, metric := range m {
+		ch <- metric.desc
+	}
+}
+
+// collect sends the values of the metrics of entry, labelled with
+// labelValues, to ch.
+func (m labelledMetrics) collect(ch chan<- prometheus.Metric, entry interface{}, labelValues ...string) {
+	for _, metric := range m {
+		if value := metric.eval(entry); value != nil {
+			ch <- prometheus.MustNewConstMetric(metric.desc, metric.valType, *value, labelValues...)
+		}
+	}
 }
@@ -0,0 +1,191 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/expfmt"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// loadStats decodes the stats in testdata/stats.json, which hold every field
+// of Stats with a distinct value, so that an extractor reading the wrong
+// field shows up as a wrong value.
+func loadStats(t *testing.T) *Stats {
+	t.Helper()
+	body, err := ioutil.ReadFile(filepath.Join("testdata", "stats.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := &Stats{}
+	if err := json.Unmarshal(body, stats); err != nil {
+		t.Fatal(err)
+	}
+	return stats
+}
+
+// compareGolden compares the metrics of c with the golden file
+// testdata/<name>.prom, or writes the file with -update.
+func compareGolden(t *testing.T, c prometheus.Collector, name string) {
+	t.Helper()
+	golden := filepath.Join("testdata", name+".prom")
+	if *update {
+		registry := prometheus.NewPedanticRegistry()
+		registry.MustRegister(c)
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		for _, family := range families {
+			if _, err := expfmt.MetricFamilyToText(&out, family); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := ioutil.WriteFile(golden, out.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := os.Open(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer expected.Close()
+	if err := testutil.CollectAndCompare(c, expected); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestExportedMetrics checks the name, help, labels, type and value of every
+// metric of the collectors built on exportedMetrics against the fixture.
+func TestExportedMetrics(t *testing.T) {
+	tests := []struct {
+		name      string
+		beat      string
+		collector func(beatInfo *BeatInfo, stats *Stats) prometheus.Collector
+	}{
+		{"system", "filebeat", NewSystemCollector},
+		{"beat", "filebeat", NewBeatCollector},
+		{"libbeat", "filebeat", NewLibBeatCollector},
+		{"registrar", "filebeat", NewRegistrarCollector},
+		{"filebeat", "filebeat", NewFilebeatCollector},
+		{"journald", "filebeat", NewJournaldCollector},
+		{"metricbeat", "metricbeat", NewMetricbeatCollector},
+		{"auditd", "auditbeat", NewAuditdCollector},
+		{"heartbeat", "heartbeat", NewHeartbeatCollector},
+		{"packetbeat", "packetbeat", NewPacketbeatCollector},
+		{"apmserver", "apm-server", NewAPMServerCollector},
+		{"winlogbeat", "winlogbeat", NewWinlogbeatCollector},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			beatInfo := &BeatInfo{Beat: test.beat, Version: "8.12.0"}
+			compareGolden(t, test.collector(beatInfo, loadStats(t)), test.name)
+		})
+	}
+}
+
+// TestLegacyNames checks the series of the collectors whose names or labels
+// LegacyNames changes.
+func TestLegacyNames(t *testing.T) {
+	beatInfo := &BeatInfo{Beat: "filebeat", Version: "8.12.0", Naming: Naming{LegacyNames: true}}
+	compareGolden(t, NewFilebeatCollector(beatInfo, loadStats(t)), "filebeat-legacy")
+	compareGolden(t, NewLibBeatCollector(beatInfo, loadStats(t)), "libbeat-legacy")
+}
+
+// TestDerivedMetrics checks the series of the libbeat collector with the
+// derived metrics, which are left out until the output sent a batch.
+func TestDerivedMetrics(t *testing.T) {
+	beatInfo := &BeatInfo{Beat: "filebeat", Version: "8.12.0", Naming: Naming{DerivedMetrics: true}}
+	compareGolden(t, NewLibBeatCollector(beatInfo, loadStats(t)), "libbeat-derived")
+
+	stats := loadStats(t)
+	stats.LibBeat.Output.Events.Batches = 0
+	if count := testutil.CollectAndCount(NewLibBeatCollector(beatInfo, stats), "filebeat_libbeat_output_events_per_batch"); count != 0 {
+		t.Errorf("exported the batch size before the output sent a batch")
+	}
+}
+
+// TestExportedMetricsValid checks that every metric of a table, including
+// those collected only when the Beat reports their section, can be
+// collected: its descriptor is valid and its extractor returns a value for
+// each of its variable labels.
+func TestExportedMetricsValid(t *testing.T) {
+	beatInfo := &BeatInfo{Beat: "filebeat"}
+	stats := loadStats(t)
+	tables := map[string]exportedMetrics{
+		"system":       NewSystemCollector(beatInfo, stats).(*systemCollector).metrics,
+		"beat":         NewBeatCollector(beatInfo, stats).(*beatCollector).metrics,
+		"libbeat":      NewLibBeatCollector(beatInfo, stats).(*libbeatCollector).metrics,
+		"disk queue":   NewLibBeatCollector(beatInfo, stats).(*libbeatCollector).diskQueue,
+		"autodiscover": NewLibBeatCollector(beatInfo, stats).(*libbeatCollector).autodiscover,
+		"registrar":    NewRegistrarCollector(beatInfo, stats).(*registrarCollector).metrics,
+		"filebeat":     NewFilebeatCollector(beatInfo, stats).(*filebeatCollector).metrics,
+		"journald":     NewJournaldCollector(beatInfo, stats).(*journaldCollector).metrics,
+		"metricbeat":   NewMetricbeatCollector(beatInfo, stats).(*metricbeatCollector).metrics,
+		"auditd":       NewAuditdCollector(beatInfo, stats).(*auditdCollector).metrics,
+		"heartbeat":    NewHeartbeatCollector(beatInfo, stats).(*heartbeatCollector).metrics,
+		"packetbeat":   NewPacketbeatCollector(beatInfo, stats).(*packetbeatCollector).metrics,
+		"apmserver":    NewAPMServerCollector(beatInfo, stats).(*apmServerCollector).metrics,
+	}
+	for name, table := range tables {
+		if len(table) == 0 {
+			t.Errorf("%s: empty table", name)
+		}
+		for _, metric := range table {
+			var labels []string
+			if metric.labels != nil {
+				labels = metric.labels(stats)
+			}
+			if _, err := prometheus.NewConstMetric(metric.desc, metric.valType, metric.eval(stats), labels...); err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+			switch metric.valType {
+			case prometheus.CounterValue, prometheus.GaugeValue, prometheus.UntypedValue:
+			default:
+				t.Errorf("%s: %s has value type %v", name, metric.desc, metric.valType)
+			}
+		}
+	}
+}
+
+// TestLibBeatOptionalSections checks that the sections only some Beats
+// report aren't exported as zeros by the others.
+func TestLibBeatOptionalSections(t *testing.T) {
+	stats := loadStats(t)
+	stats.LibBeat.Autodiscover = nil
+	c := NewLibBeatCollector(&BeatInfo{Beat: "filebeat", Version: "8.12.0"}, stats)
+	names := []string{
+		"filebeat_libbeat_autodiscover_events_received_total",
+		"filebeat_libbeat_autodiscover_configs_started_total",
+		"filebeat_libbeat_autodiscover_configs_stopped_total",
+		"filebeat_libbeat_autodiscover_errors_total",
+	}
+	if count := testutil.CollectAndCount(c, names...); count != 0 {
+		t.Errorf("exported %d autodiscover metrics without autodiscover stats, want 0", count)
+	}
+}
+
+// TestDecodeInvalidSections checks that sections of the stats decoded by
+// hand fail the decoding when they are malformed.
+func TestDecodeInvalidSections(t *testing.T) {
+	tests := map[string]string{
+		"libbeat processors":  `{"libbeat":{"processors":["drop_event"]}}`,
+		"metricbeat modules":  `{"metricbeat":["system"]}`,
+		"winlogbeat channels": `{"winlogbeat":{"channels":["Security"]}}`,
+	}
+	for name, body := range tests {
+		if err := json.Unmarshal([]byte(body), &Stats{}); err == nil {
+			t.Errorf("%s: decoded %s without error", name, body)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// traceIDKey is the context key of the ID of a sampled trace a scrape is
+// part of.
+type traceIDKey struct{}
+
+// ContextWithTraceParent returns ctx carrying the trace ID of a W3C
+// traceparent header, e.g. one set by a tracing proxy in front of the
+// exporter, if its span is sampled. Otherwise ctx is returned unchanged.
+func ContextWithTraceParent(ctx context.Context, traceParent string) context.Context {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return ctx
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return ctx
+	}
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || isZero(traceID) {
+		return ctx
+	}
+	if _, err := hex.DecodeString(parts[2]); err != nil {
+		return ctx
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || flags[0]&0x01 == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, traceIDKey{}, strings.ToLower(parts[1]))
+}
+
+// sampledTraceID returns the trace ID carried by ctx, if any.
+func sampledTraceID(ctx context.Context) (string, bool) {
+	traceID, ok := ctx.Value(traceIDKey{}).(string)
+	return traceID, ok
+}
+
+// observe records value in histogram, with the trace ID of a sampled span in
+// ctx as exemplar so that slow requests can be looked up in the trace.
+func observe(ctx context.Context, histogram prometheus.Histogram, value float64) {
+	if traceID, ok := sampledTraceID(ctx); ok {
+		if observer, ok := histogram.(prometheus.ExemplarObserver); ok {
+			observer.ObserveWithExemplar(value, prometheus.Labels{"trace_id": traceID})
+			return
+		}
+	}
+	histogram.Observe(value)
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
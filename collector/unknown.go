@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// unknownField is a numeric field of the stats of a Beat that no collector
+// exports.
+type unknownField struct {
+	path  string
+	value float64
+}
+
+// knownFields holds the dotted paths of the numeric fields decoded into
+// Stats, which are left to the collectors. A * segment matches any key, for
+// sections decoded into maps.
+var knownFields = structFields(reflect.TypeOf(MetricbeatEvent{}), "metricbeat.*.*.",
+	structFields(reflect.TypeOf(Stats{}), "", map[string]bool{}))
+
+// isKnownField reports whether the field at path is in knownFields.
+func isKnownField(path string) bool {
+	if knownFields[path] {
+		return true
+	}
+	segments := strings.Split(path, ".")
+	for known := range knownFields {
+		if !strings.Contains(known, "*") {
+			continue
+		}
+		knownSegments := strings.Split(known, ".")
+		if len(knownSegments) != len(segments) {
+			continue
+		}
+		match := true
+		for i := range segments {
+			if knownSegments[i] != "*" && knownSegments[i] != segments[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// structFields adds the dotted paths of the numeric fields of t, following
+// their json tags, to fields.
+func structFields(t reflect.Type, prefix string, fields map[string]bool) map[string]bool {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			// Fields of embedded structs are decoded as if they were
+			// fields of the outer struct.
+			structFields(field.Type, prefix, fields)
+			continue
+		}
+		if name == "" || name == "-" {
+			continue
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		switch fieldType.Kind() {
+		case reflect.Struct:
+			structFields(fieldType, prefix+name+".", fields)
+		case reflect.Map:
+			if fieldType.Elem().Kind() == reflect.Struct {
+				structFields(fieldType.Elem(), prefix+name+".*.", fields)
+			}
+		case reflect.Float32, reflect.Float64,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			fields[prefix+name] = true
+		}
+	}
+	return fields
+}
+
+// unknownFields returns the numeric fields of the stats in body that are
+// missing from Stats, sorted by path.
+func unknownFields(body []byte) ([]unknownField, error) {
+	var stats map[string]interface{}
+	if err := json.Unmarshal(body, &stats); err != nil {
+		return nil, err
+	}
+	var leaves, fields []unknownField
+	flattenFields(stats, "", &leaves)
+	for _, leaf := range leaves {
+		if !isKnownField(leaf.path) {
+			fields = append(fields, leaf)
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].path < fields[j].path })
+	return fields, nil
+}
+
+// flattenFields appends the numeric leaves of object to fields.
+func flattenFields(object map[string]interface{}, prefix string, fields *[]unknownField) {
+	for key, value := range object {
+		path := prefix + key
+		switch value := value.(type) {
+		case map[string]interface{}:
+			flattenFields(value, path+".", fields)
+		case float64:
+			*fields = append(*fields, unknownField{path: path, value: value})
+		}
+	}
+}
+
+// unknownFieldName returns the metric name of the field at path, e.g.
+// filebeat_libbeat_output_events_toomany for libbeat.output.events.toomany.
+func unknownFieldName(namespace, path string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, path)
+	return prometheus.BuildFQName(namespace, "", name)
+}
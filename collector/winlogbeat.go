@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"encoding/json"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WinlogbeatChannel json structure of the stats of one event log channel
+type WinlogbeatChannel struct {
+	// LastRecordNumber is the record number of the last event published
+	// from the channel.
+	LastRecordNumber float64 `json:"last_record_number"`
+	// LatestRecordNumber is the record number of the newest event in the
+	// channel.
+	LatestRecordNumber float64 `json:"latest_record_number"`
+}
+
+// WinlogbeatChannels holds the stats of the event log channels by name,
+// e.g. Security.
+type WinlogbeatChannels map[string]WinlogbeatChannel
+
+// UnmarshalJSON decodes the channels section, skipping the entries that
+// aren't channels.
+func (c *WinlogbeatChannels) UnmarshalJSON(data []byte) error {
+	var channels map[string]json.RawMessage
+	if err := json.Unmarshal(data, &channels); err != nil {
+		return err
+	}
+	*c = WinlogbeatChannels{}
+	for name, raw := range channels {
+		var channel WinlogbeatChannel
+		if err := json.Unmarshal(raw, &channel); err != nil {
+			continue
+		}
+		(*c)[name] = channel
+	}
+	return nil
+}
+
+// Winlogbeat json structure
+type Winlogbeat struct {
+	Channels WinlogbeatChannels `json:"channels"`
+}
+
+type winlogbeatCollector struct {
+	beatInfo *BeatInfo
+	stats    *Stats
+	last     *prometheus.Desc
+	latest   *prometheus.Desc
+	lag      *prometheus.Desc
+}
+
+// NewWinlogbeatCollector constructor
+func NewWinlogbeatCollector(beatInfo *BeatInfo, stats *Stats) prometheus.Collector {
+	return &winlogbeatCollector{
+		beatInfo: beatInfo,
+		stats:    stats,
+		last: prometheus.NewDesc(
+			prometheus.BuildFQName(beatInfo.namespace(), "channel", "last_published_record"),
+			"winlogbeat.channels.last_record_number",
+			[]string{"channel"}, nil,
+		),
+		latest: prometheus.NewDesc(
+			prometheus.BuildFQName(beatInfo.namespace(), "channel", "latest_record"),
+			"winlogbeat.channels.latest_record_number",
+			[]string{"channel"}, nil,
+		),
+		lag: prometheus.NewDesc(
+			prometheus.BuildFQName(beatInfo.namespace(), "channel", "lag_records"),
+			"Records of the channel not published yet.",
+			[]string{"channel"}, nil,
+		),
+	}
+}
+
+// Describe returns all descriptions of the collector.
+func (c *winlogbeatCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	ch <- c.last
+	ch <- c.latest
+	ch <- c.lag
+
+}
+
+// Collect returns the current state of all metrics of the collector.
+func (c *winlogbeatCollector) Collect(ch chan<- prometheus.Metric) {
+
+	for name, channel := range c.stats.Winlogbeat.Channels {
+		lag := channel.LatestRecordNumber - channel.LastRecordNumber
+		if lag < 0 {
+			// The channel was cleared or wrapped around.
+			lag = 0
+		}
+		ch <- prometheus.MustNewConstMetric(c.last, prometheus.GaugeValue, channel.LastRecordNumber, name)
+		ch <- prometheus.MustNewConstMetric(c.latest, prometheus.GaugeValue, channel.LatestRecordNumber, name)
+		ch <- prometheus.MustNewConstMetric(c.lag, prometheus.GaugeValue, lag, name)
+	}
+
+}
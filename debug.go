@@ -0,0 +1,27 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// startDebugServer serves the pprof profiles under /debug/pprof/ and the
+// expvar variables under /debug/vars on their own listener, so that they
+// can be kept off the address scraped by Prometheus.
+func startDebugServer(listenAddress string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	log.Infof("Starting debug server at %s", listenAddress)
+	if err := http.ListenAndServe(listenAddress, mux); err != nil {
+		log.Fatalf("Debug server error: %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/trustpilot/beat-exporter/collector"
+	"github.com/trustpilot/beat-exporter/internal/config"
+)
+
+// dryRun discovers every target once and prints the catalogue of metrics it
+// would expose. It returns an error if any target could not be scraped.
+func dryRun(w io.Writer, targetConfigs []config.TargetConfig, options scrapeOptions) error {
+	var failed []string
+	for _, tc := range targetConfigs {
+		t, err := newTarget(tc, options)
+		if err != nil {
+			fmt.Fprintf(w, "# %s: %v\n\n", tc.URI, err)
+			failed = append(failed, tc.URI)
+			continue
+		}
+
+		families, err := t.registry.Gather()
+		t.close()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "# %s\n", tc.URI)
+		printMetricCatalogue(w, families)
+		fmt.Fprintln(w)
+		switch {
+		case t.info.Naming.CleanNames:
+			printRenames(w, "--metrics.clean-names", collector.CleanNameRenames(t.info), families, options.namespace)
+		case t.info.Naming.LegacyNames:
+			printRenames(w, "--compat.legacy-names", collector.LegacyNameRenames(t.info), families, options.namespace)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to discover %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// printMetricCatalogue writes one line per metric family with its type,
+// label names and help text.
+func printMetricCatalogue(w io.Writer, families []*dto.MetricFamily) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tLABELS\tHELP")
+	for _, mf := range families {
+		labelNames := map[string]bool{}
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				labelNames[lp.GetName()] = true
+			}
+		}
+		labels := make([]string, 0, len(labelNames))
+		for name := range labelNames {
+			labels = append(labels, name)
+		}
+		sort.Strings(labels)
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+			mf.GetName(), strings.ToLower(mf.GetType().String()), strings.Join(labels, ","), mf.GetHelp())
+	}
+	tw.Flush()
+}
+
+// printRenames writes the migration table of the series the target exposes
+// renamed by flag, prefixed with namespace like its metrics.
+func printRenames(w io.Writer, flag string, renames []collector.Rename, families []*dto.MetricFamily, namespace string) {
+	exposed := make(map[string]bool, len(families))
+	for _, mf := range families {
+		exposed[mf.GetName()] = true
+	}
+	prefix := ""
+	if namespace != "" {
+		prefix = namespace + "_"
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	header := false
+	for _, r := range renames {
+		if !exposed[prefix+seriesName(r.Old)] && !exposed[prefix+seriesName(r.New)] {
+			continue
+		}
+		if !header {
+			fmt.Fprintln(tw, "# Renamed by "+flag)
+			fmt.Fprintln(tw, "OLD\tNEW")
+			header = true
+		}
+		fmt.Fprintf(tw, "%s%s\t%s%s\n", prefix, r.Old, prefix, r.New)
+	}
+	tw.Flush()
+	if header {
+		fmt.Fprintln(w)
+	}
+}
+
+// seriesName returns the metric name of a series such as
+// filebeat_filebeat_events{event="active"}.
+func seriesName(series string) string {
+	return strings.SplitN(series, "{", 2)[0]
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const envPrefix = "BEAT_EXPORTER_"
+
+// flagEnvName returns the environment variable that can set the given flag,
+// e.g. web.listen-address becomes BEAT_EXPORTER_WEB_LISTEN_ADDRESS.
+func flagEnvName(name string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(name))
+}
+
+// applyEnvOverrides sets every flag not given on the command line from its
+// environment variable, if present, and returns the names of all flags that
+// were set explicitly by either source.
+func applyEnvOverrides(fs *flag.FlagSet) (map[string]bool, error) {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || explicit[f.Name] {
+			return
+		}
+		value, ok := os.LookupEnv(flagEnvName(f.Name))
+		if !ok {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value %q for %s: %w", value, flagEnvName(f.Name), setErr)
+			return
+		}
+		explicit[f.Name] = true
+	})
+	return explicit, err
+}
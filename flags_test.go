@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// setEnv sets the environment variable key for the rest of the test.
+func setEnv(t *testing.T, key, value string) {
+	t.Helper()
+	old, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestFlagEnvName(t *testing.T) {
+	tests := map[string]string{
+		"web.listen-address":     "BEAT_EXPORTER_WEB_LISTEN_ADDRESS",
+		"beat.uris":              "BEAT_EXPORTER_BEAT_URIS",
+		"compat.legacy-names":    "BEAT_EXPORTER_COMPAT_LEGACY_NAMES",
+		"web.max-requests":       "BEAT_EXPORTER_WEB_MAX_REQUESTS",
+		"collect.unknown-fields": "BEAT_EXPORTER_COLLECT_UNKNOWN_FIELDS",
+	}
+	for name, want := range tests {
+		if got := flagEnvName(name); got != want {
+			t.Errorf("flagEnvName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		env          map[string]string
+		wantAddress  string
+		wantRequests int
+		wantDebug    bool
+		wantExplicit []string
+		wantErr      bool
+	}{
+		{
+			name:         "defaults",
+			wantAddress:  ":9479",
+			wantRequests: 40,
+		},
+		{
+			name: "environment",
+			env: map[string]string{
+				"BEAT_EXPORTER_WEB_LISTEN_ADDRESS": ":9000",
+				"BEAT_EXPORTER_WEB_MAX_REQUESTS":   "5",
+				"BEAT_EXPORTER_DEBUG":              "true",
+			},
+			wantAddress:  ":9000",
+			wantRequests: 5,
+			wantDebug:    true,
+			wantExplicit: []string{"web.listen-address", "web.max-requests", "debug"},
+		},
+		{
+			name:         "flag",
+			args:         []string{"-web.listen-address=:9100"},
+			wantAddress:  ":9100",
+			wantRequests: 40,
+			wantExplicit: []string{"web.listen-address"},
+		},
+		{
+			name:         "flag over environment",
+			args:         []string{"-web.listen-address=:9100", "-debug=false"},
+			env:          map[string]string{"BEAT_EXPORTER_WEB_LISTEN_ADDRESS": ":9000", "BEAT_EXPORTER_DEBUG": "true"},
+			wantAddress:  ":9100",
+			wantRequests: 40,
+			wantExplicit: []string{"web.listen-address", "debug"},
+		},
+		{
+			name:         "empty environment value",
+			env:          map[string]string{"BEAT_EXPORTER_WEB_LISTEN_ADDRESS": ""},
+			wantAddress:  "",
+			wantRequests: 40,
+			wantExplicit: []string{"web.listen-address"},
+		},
+		{
+			name:    "invalid integer",
+			env:     map[string]string{"BEAT_EXPORTER_WEB_MAX_REQUESTS": "many"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid boolean",
+			env:     map[string]string{"BEAT_EXPORTER_DEBUG": "maybe"},
+			wantErr: true,
+		},
+		{
+			name:         "invalid environment value under a flag",
+			args:         []string{"-web.max-requests=5"},
+			env:          map[string]string{"BEAT_EXPORTER_WEB_MAX_REQUESTS": "many"},
+			wantAddress:  ":9479",
+			wantRequests: 5,
+			wantExplicit: []string{"web.max-requests"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("beat-exporter", flag.ContinueOnError)
+			fs.SetOutput(ioutil.Discard)
+			address := fs.String("web.listen-address", ":9479", "")
+			requests := fs.Int("web.max-requests", 40, "")
+			debug := fs.Bool("debug", false, "")
+			if err := fs.Parse(test.args); err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range test.env {
+				setEnv(t, key, value)
+			}
+
+			explicit, err := applyEnvOverrides(fs)
+			if test.wantErr {
+				if err == nil || !strings.Contains(err.Error(), envPrefix) {
+					t.Fatalf("err = %v, want an error naming the environment variable", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *address != test.wantAddress {
+				t.Errorf("web.listen-address = %q, want %q", *address, test.wantAddress)
+			}
+			if *requests != test.wantRequests {
+				t.Errorf("web.max-requests = %d, want %d", *requests, test.wantRequests)
+			}
+			if *debug != test.wantDebug {
+				t.Errorf("debug = %v, want %v", *debug, test.wantDebug)
+			}
+			if len(explicit) != len(test.wantExplicit) {
+				t.Errorf("explicit flags = %v, want %v", explicit, test.wantExplicit)
+			}
+			for _, name := range test.wantExplicit {
+				if !explicit[name] {
+					t.Errorf("%s not reported as explicitly set", name)
+				}
+			}
+		})
+	}
+}
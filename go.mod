@@ -3,9 +3,14 @@ module github.com/trustpilot/beat-exporter
 go 1.12
 
 require (
-	github.com/konsorten/go-windows-terminal-sequences v1.0.2 // indirect
-	github.com/prometheus/client_golang v1.3.0
-	github.com/prometheus/common v0.8.0
-	github.com/sirupsen/logrus v1.4.2
-	golang.org/x/sys v0.0.0-20200113162924-86b910548bc1
+	github.com/Microsoft/go-winio v0.4.16
+	github.com/fsnotify/fsnotify v1.4.9
+	github.com/prometheus/client_golang v1.11.0
+	github.com/prometheus/client_model v0.2.0
+	github.com/prometheus/common v0.29.0
+	github.com/prometheus/exporter-toolkit v0.7.3
+	github.com/sirupsen/logrus v1.6.0
+	golang.org/x/net v0.0.0-20210525063256-abc453219eb5
+	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1
+	gopkg.in/yaml.v2 v2.4.0
 )
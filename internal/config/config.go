@@ -0,0 +1,615 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// CurrentVersion is the newest configuration schema version.
+const CurrentVersion = 1
+
+// Config is the structure of the exporter configuration file.
+type Config struct {
+	Version int                    `yaml:"version"`
+	Targets []TargetConfig         `yaml:"targets"`
+	Modules map[string]ProbeModule `yaml:"modules,omitempty"`
+	// MetricRelabelConfigs are applied to every series before exposition.
+	MetricRelabelConfigs []RelabelConfig `yaml:"metric_relabel_configs,omitempty"`
+	// BeatTypes maps the names of custom Beats to how they are scraped.
+	BeatTypes map[string]BeatTypeConfig `yaml:"beat_types,omitempty"`
+
+	// Warnings lists deprecated options found while migrating an older schema.
+	Warnings []Warning `yaml:"-"`
+}
+
+// BeatTypeConfig tells how to scrape a custom Beat, e.g. one built on
+// libbeat in-house.
+type BeatTypeConfig struct {
+	// Type is the Beat type whose collectors apply, or GenericBeatType for
+	// those common to every Beat only.
+	Type string `yaml:"type,omitempty"`
+	// Namespace replaces the Beat name as prefix of the metric names.
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// GenericBeatType is the type of custom Beats only scraped for the metrics
+// common to every Beat.
+const GenericBeatType = "generic"
+
+// Validate checks the semantic correctness of the mapping.
+func (b *BeatTypeConfig) Validate() error {
+	if b.Namespace != "" && !model.IsValidMetricName(model.LabelValue(b.Namespace)) {
+		return fmt.Errorf("invalid namespace %q", b.Namespace)
+	}
+	return nil
+}
+
+// Warning describes a deprecated option in the configuration file.
+type Warning struct {
+	Option  string
+	Message string
+}
+
+// TargetConfig holds the settings of a single Beat target. Zero values are
+// filled from the corresponding command line flags.
+type TargetConfig struct {
+	Name       string            `yaml:"name,omitempty"`
+	URI        string            `yaml:"uri"`
+	Timeout    time.Duration     `yaml:"timeout,omitempty"`
+	TLSConfig  TLSConfig         `yaml:"tls_config,omitempty"`
+	BasicAuth  *BasicAuth        `yaml:"basic_auth,omitempty"`
+	Headers    Headers           `yaml:",inline"`
+	ProxyURL   string            `yaml:"proxy_url,omitempty"`
+	Protocol   string            `yaml:"protocol,omitempty"`
+	Labels     map[string]string `yaml:"labels,omitempty"`
+	Collectors map[string]bool   `yaml:"collectors,omitempty"`
+	// RegistryPath is the registry directory of a Filebeat, read by the
+	// filebeat-harvesters collector.
+	RegistryPath string `yaml:"registry_path,omitempty"`
+
+	// plainURI is set for targets given as a bare URI string, which is only
+	// allowed in the legacy schema.
+	plainURI bool
+}
+
+// ProbeModule bundles the settings used to scrape Beats through the /probe
+// endpoint, selected with its module parameter.
+type ProbeModule struct {
+	Timeout    time.Duration   `yaml:"timeout,omitempty"`
+	TLSConfig  TLSConfig       `yaml:"tls_config,omitempty"`
+	BasicAuth  *BasicAuth      `yaml:"basic_auth,omitempty"`
+	Headers    Headers         `yaml:",inline"`
+	ProxyURL   string          `yaml:"proxy_url,omitempty"`
+	Protocol   string          `yaml:"protocol,omitempty"`
+	Collectors map[string]bool `yaml:"collectors,omitempty"`
+}
+
+// Target returns the configuration of a target probed with the module.
+func (m ProbeModule) Target(uri string) TargetConfig {
+	return TargetConfig{
+		URI:        uri,
+		Timeout:    m.Timeout,
+		TLSConfig:  m.TLSConfig,
+		BasicAuth:  m.BasicAuth,
+		Headers:    m.Headers,
+		ProxyURL:   m.ProxyURL,
+		Protocol:   m.Protocol,
+		Collectors: m.Collectors,
+	}
+}
+
+// TLSConfig configures TLS towards a Beat served over HTTPS.
+type TLSConfig struct {
+	CAFile string `yaml:"ca_file,omitempty"`
+	// ServerName is the name the Beat certificate is verified against,
+	// instead of the host of the target URI.
+	ServerName         string `yaml:"server_name,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+	// CertFile and KeyFile hold the client certificate presented to Beats
+	// requiring mutual TLS.
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+	// KeyPassphrase decrypts a KeyFile encrypted in the legacy PEM format
+	// of OpenSSL. It can be read from KeyPassphraseFile instead of being
+	// inlined.
+	KeyPassphrase     string `yaml:"key_passphrase,omitempty"`
+	KeyPassphraseFile string `yaml:"key_passphrase_file,omitempty"`
+}
+
+// LoadKeyPair reads the client certificate and key, decrypting the key with
+// the passphrase if it is encrypted.
+func (c TLSConfig) LoadKeyPair() (tls.Certificate, error) {
+	if c.KeyPassphrase == "" && c.KeyPassphraseFile == "" {
+		return tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	}
+	certPEM, err := ioutil.ReadFile(c.CertFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyPEM, err := ioutil.ReadFile(c.KeyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	passphrase := c.KeyPassphrase
+	if c.KeyPassphraseFile != "" {
+		if passphrase, err = ReadSecretFile(c.KeyPassphraseFile); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return tls.Certificate{}, fmt.Errorf("no PEM key found in %s", c.KeyFile)
+	}
+	if x509.IsEncryptedPEMBlock(block) {
+		der, err := x509.DecryptPEMBlock(block, []byte(passphrase))
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("failed to decrypt key %s: %w", c.KeyFile, err)
+		}
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der})
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// BasicAuth holds HTTP basic authentication credentials for a Beat. The
+// password can be read from PasswordFile instead of being inlined.
+type BasicAuth struct {
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password,omitempty"`
+	PasswordFile string `yaml:"password_file,omitempty"`
+}
+
+// Headers holds static HTTP headers sent with every request to a Beat, e.g.
+// an API key expected by an authenticating gateway. Secret values can be
+// read from HeaderFiles instead of being inlined.
+type Headers struct {
+	Headers     map[string]string `yaml:"headers,omitempty"`
+	HeaderFiles map[string]string `yaml:"header_files,omitempty"`
+}
+
+// Validate checks the header names and that no header is set twice.
+func (h *Headers) Validate(basicAuth *BasicAuth) error {
+	seen := make(map[string]bool)
+	for _, names := range []map[string]string{h.Headers, h.HeaderFiles} {
+		for name := range names {
+			if name == "" || strings.ContainsAny(name, " \t:\r\n") {
+				return fmt.Errorf("invalid header name %q", name)
+			}
+			canonical := textproto.CanonicalMIMEHeaderKey(name)
+			if seen[canonical] {
+				return fmt.Errorf("header %s is set more than once", canonical)
+			}
+			seen[canonical] = true
+		}
+	}
+	if seen["Authorization"] && basicAuth != nil {
+		return fmt.Errorf("the Authorization header can't be combined with basic_auth")
+	}
+	return nil
+}
+
+// Has reports whether the header with the given name is set.
+func (h *Headers) Has(name string) bool {
+	for _, names := range []map[string]string{h.Headers, h.HeaderFiles} {
+		for n := range names {
+			if strings.EqualFold(n, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadFiles merges the content of every header file into Headers.
+func (h *Headers) loadFiles() error {
+	if len(h.HeaderFiles) == 0 {
+		return nil
+	}
+	headers := make(map[string]string, len(h.Headers)+len(h.HeaderFiles))
+	for name, value := range h.Headers {
+		headers[name] = value
+	}
+	for name, file := range h.HeaderFiles {
+		value, err := ReadSecretFile(file)
+		if err != nil {
+			return fmt.Errorf("header %s: %w", name, err)
+		}
+		headers[name] = value
+	}
+	h.Headers = headers
+	return nil
+}
+
+// TargetLabel is the label carrying the target name, or the URI of unnamed
+// targets, on every exported metric.
+const TargetLabel = "target"
+
+// ParseLabels parses a comma-separated list of name=value label pairs, such
+// as env=prod,team=logging.
+func ParseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	if s == "" {
+		return labels, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid label %q, expected name=value", pair)
+		}
+		name := strings.TrimSpace(parts[0])
+		if !model.LabelName(name).IsValid() {
+			return nil, fmt.Errorf("invalid label name %q", name)
+		}
+		if name == TargetLabel {
+			return nil, fmt.Errorf("label %q is reserved for the target name", TargetLabel)
+		}
+		if _, ok := labels[name]; ok {
+			return nil, fmt.Errorf("duplicate label %q", name)
+		}
+		labels[name] = parts[1]
+	}
+	return labels, nil
+}
+
+// ConstLabels returns the labels added to every metric of the target. Every
+// target gets a TargetLabel, so that the metrics of several Beats of the
+// same type can be told apart.
+func (t *TargetConfig) ConstLabels() map[string]string {
+	labels := make(map[string]string, len(t.Labels)+1)
+	for name, value := range t.Labels {
+		labels[name] = value
+	}
+	if t.Name != "" {
+		labels[TargetLabel] = t.Name
+	} else if _, ok := labels[TargetLabel]; !ok {
+		labels[TargetLabel] = t.URI
+	}
+	return labels
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler. A target may be given either as
+// a plain URI string or as a mapping.
+func (t *TargetConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var uri string
+	if err := unmarshal(&uri); err == nil {
+		*t = TargetConfig{URI: uri, plainURI: true}
+		return nil
+	}
+
+	type plain TargetConfig
+	return unmarshal((*plain)(t))
+}
+
+// Load parses the YAML input into a Config.
+func Load(content []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.migrate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.loadSecrets(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// migrate upgrades an older configuration schema in place to CurrentVersion,
+// recording a warning for every deprecated option it comes across.
+func (c *Config) migrate() error {
+	if c.Version < 0 || c.Version > CurrentVersion {
+		return fmt.Errorf("unsupported config version %d, this exporter supports up to version %d", c.Version, CurrentVersion)
+	}
+
+	legacy := c.Version == 0
+	if legacy {
+		c.warn("version", fmt.Sprintf("no version set, assuming the legacy schema; add `version: %d`", CurrentVersion))
+		c.Version = 1
+	}
+
+	for i, t := range c.Targets {
+		if !t.plainURI {
+			continue
+		}
+		option := fmt.Sprintf("targets[%d]", i)
+		if !legacy {
+			return fmt.Errorf("%s: plain URI targets are not supported in version %d, use a mapping with `uri`", option, c.Version)
+		}
+		c.warn(option, "plain URI targets are deprecated, use a mapping with `uri` instead")
+	}
+	return nil
+}
+
+func (c *Config) warn(option, message string) {
+	c.Warnings = append(c.Warnings, Warning{Option: option, Message: message})
+}
+
+// Validate checks the semantic correctness of the configuration.
+func (c *Config) Validate() error {
+	names := make(map[string]bool)
+	for _, target := range c.Targets {
+		if err := target.Validate(); err != nil {
+			return err
+		}
+		if target.Name != "" {
+			if names[target.Name] {
+				return fmt.Errorf("duplicate target name %q", target.Name)
+			}
+			names[target.Name] = true
+		}
+	}
+	for name, module := range c.Modules {
+		if err := module.Validate(); err != nil {
+			return fmt.Errorf("module %s: %w", name, err)
+		}
+	}
+	for i, rc := range c.MetricRelabelConfigs {
+		if err := rc.Validate(); err != nil {
+			return fmt.Errorf("metric_relabel_configs[%d]: %w", i, err)
+		}
+	}
+	for name, beatType := range c.BeatTypes {
+		if err := beatType.Validate(); err != nil {
+			return fmt.Errorf("beat type %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks the semantic correctness of the probe module.
+func (m *ProbeModule) Validate() error {
+	if m.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	if err := m.Headers.Validate(m.BasicAuth); err != nil {
+		return err
+	}
+	if err := validateProxyURL(m.ProxyURL); err != nil {
+		return err
+	}
+	if err := validateProtocol(m.Protocol, m.ProxyURL); err != nil {
+		return err
+	}
+	return validateClientSettings(m.BasicAuth, m.TLSConfig)
+}
+
+// Validate checks the semantic correctness of the target configuration.
+func (t *TargetConfig) Validate() error {
+	if err := ValidateURI(t.URI); err != nil {
+		return err
+	}
+	if t.Timeout < 0 {
+		return fmt.Errorf("target %s: timeout must not be negative", t.URI)
+	}
+	for name := range t.Labels {
+		if !model.LabelName(name).IsValid() {
+			return fmt.Errorf("target %s: invalid label name %q", t.URI, name)
+		}
+	}
+	if _, ok := t.Labels[TargetLabel]; ok && t.Name != "" {
+		return fmt.Errorf("target %s: label %q conflicts with the target name", t.URI, TargetLabel)
+	}
+	if err := t.Headers.Validate(t.BasicAuth); err != nil {
+		return fmt.Errorf("target %s: %w", t.URI, err)
+	}
+	if err := validateProxyURL(t.ProxyURL); err != nil {
+		return fmt.Errorf("target %s: %w", t.URI, err)
+	}
+	if t.ProxyURL != "" && (strings.HasPrefix(t.URI, "unix://") || strings.HasPrefix(t.URI, "npipe://")) {
+		return fmt.Errorf("target %s: proxy_url can't be used with a Unix socket or named pipe", t.URI)
+	}
+	if err := validateProtocol(t.Protocol, t.ProxyURL); err != nil {
+		return fmt.Errorf("target %s: %w", t.URI, err)
+	}
+	if t.Protocol == ProtocolH2C && strings.HasPrefix(t.URI, "https://") {
+		return fmt.Errorf("target %s: protocol %s can't be used with https", t.URI, ProtocolH2C)
+	}
+	if err := validateClientSettings(t.BasicAuth, t.TLSConfig); err != nil {
+		return fmt.Errorf("target %s: %w", t.URI, err)
+	}
+	return nil
+}
+
+// validateClientSettings checks the settings of the HTTP client talking to a Beat.
+func validateClientSettings(basicAuth *BasicAuth, tlsConfig TLSConfig) error {
+	if basicAuth != nil {
+		if basicAuth.Username == "" {
+			return fmt.Errorf("basic_auth requires a username")
+		}
+		if basicAuth.Password != "" && basicAuth.PasswordFile != "" {
+			return fmt.Errorf("at most one of basic_auth password and password_file must be set")
+		}
+	}
+	if tlsConfig.CAFile != "" {
+		if _, err := ioutil.ReadFile(tlsConfig.CAFile); err != nil {
+			return err
+		}
+	}
+	if (tlsConfig.CertFile == "") != (tlsConfig.KeyFile == "") {
+		return fmt.Errorf("tls_config cert_file and key_file must be set together")
+	}
+	if tlsConfig.KeyPassphrase != "" && tlsConfig.KeyPassphraseFile != "" {
+		return fmt.Errorf("at most one of tls_config key_passphrase and key_passphrase_file must be set")
+	}
+	if (tlsConfig.KeyPassphrase != "" || tlsConfig.KeyPassphraseFile != "") && tlsConfig.KeyFile == "" {
+		return fmt.Errorf("tls_config key_passphrase requires key_file")
+	}
+	if tlsConfig.CertFile != "" {
+		if _, err := tlsConfig.LoadKeyPair(); err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+	}
+	return nil
+}
+
+// Protocols the HTTP client can be restricted to. By default HTTP/2 is
+// negotiated with Beats served over HTTPS, and HTTP/1.1 used otherwise.
+const (
+	// ProtocolHTTP1 disables HTTP/2, also over HTTPS.
+	ProtocolHTTP1 = "http/1.1"
+	// ProtocolH2C speaks HTTP/2 over cleartext connections, without
+	// upgrading them from HTTP/1.1 first.
+	ProtocolH2C = "h2c"
+)
+
+// validateProtocol checks that the protocol, if set, is one the HTTP client
+// supports. h2c connections are made directly, so they can't be proxied.
+func validateProtocol(protocol, proxyURL string) error {
+	switch protocol {
+	case "", ProtocolHTTP1:
+	case ProtocolH2C:
+		if proxyURL != "" {
+			return fmt.Errorf("protocol %s can't be used with proxy_url", ProtocolH2C)
+		}
+	default:
+		return fmt.Errorf("unsupported protocol %q, expected one of %s, %s", protocol, ProtocolHTTP1, ProtocolH2C)
+	}
+	return nil
+}
+
+// validateProxyURL checks that the proxy URL, if set, is one the HTTP client
+// can dial through.
+func validateProxyURL(proxyURL string) error {
+	if proxyURL == "" {
+		return nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return fmt.Errorf("invalid proxy_url: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("invalid proxy_url %q: unsupported scheme %q, expected one of http, https, socks5", proxyURL, u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid proxy_url %q: missing host", proxyURL)
+	}
+	return nil
+}
+
+// loadSecrets replaces every *_file setting with the content of its file.
+// It runs on each (re)load, so rotated secrets are picked up on SIGHUP.
+func (c *Config) loadSecrets() error {
+	for i := range c.Targets {
+		t := &c.Targets[i]
+		if err := t.BasicAuth.loadPassword(); err != nil {
+			return fmt.Errorf("target %s: %w", t.URI, err)
+		}
+		if err := t.Headers.loadFiles(); err != nil {
+			return fmt.Errorf("target %s: %w", t.URI, err)
+		}
+	}
+	for name, module := range c.Modules {
+		if err := module.BasicAuth.loadPassword(); err != nil {
+			return fmt.Errorf("module %s: %w", name, err)
+		}
+		if err := module.Headers.loadFiles(); err != nil {
+			return fmt.Errorf("module %s: %w", name, err)
+		}
+		c.Modules[name] = module
+	}
+	return nil
+}
+
+func (b *BasicAuth) loadPassword() error {
+	if b == nil || b.PasswordFile == "" {
+		return nil
+	}
+	password, err := ReadSecretFile(b.PasswordFile)
+	if err != nil {
+		return err
+	}
+	b.Password = password
+	return nil
+}
+
+// ReadSecretFile returns the content of a secret file, without the trailing
+// newline that editors and most secret stores add.
+func ReadSecretFile(filename string) (string, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// ParseURI parses a Beat URI. Zones of IPv6 literals, which URLs require to
+// be escaped as in http://[fe80::1%25eth0]:5066, may also be given unescaped
+// as in http://[fe80::1%eth0]:5066.
+func ParseURI(beatURI string) (*url.URL, error) {
+	if start := strings.Index(beatURI, "://["); start >= 0 {
+		if end := strings.Index(beatURI[start:], "]"); end >= 0 {
+			host := beatURI[start : start+end]
+			if zone := strings.Index(host, "%"); zone >= 0 && !strings.HasPrefix(host[zone:], "%25") {
+				beatURI = beatURI[:start+zone] + "%25" + beatURI[start+zone+1:]
+			}
+		}
+	}
+	return url.Parse(beatURI)
+}
+
+// ValidateURI checks that the given Beat URI can be scraped by the exporter.
+func ValidateURI(beatURI string) error {
+	// Without a scheme, addresses such as [::1]:5066 or localhost:5066
+	// would fail to parse or be taken for a scheme of their own.
+	if !strings.Contains(beatURI, "://") {
+		return fmt.Errorf("invalid beat URI %q: missing scheme, e.g. http://", beatURI)
+	}
+	u, err := ParseURI(beatURI)
+	if err != nil {
+		return fmt.Errorf("invalid beat URI %q: %w", beatURI, err)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return fmt.Errorf("invalid beat URI %q: missing host", beatURI)
+		}
+	case "unix":
+		if u.Path == "" {
+			return fmt.Errorf("invalid beat URI %q: missing socket path", beatURI)
+		}
+	case "npipe":
+		if strings.Trim(u.Path, "/") == "" {
+			return fmt.Errorf("invalid beat URI %q: missing pipe name", beatURI)
+		}
+	default:
+		return fmt.Errorf("invalid beat URI %q: unsupported scheme %q", beatURI, u.Scheme)
+	}
+	return nil
+}
+
+// PipePath returns the Windows named pipe path of an npipe URI, following the
+// Beats convention: npipe:///filebeat is the pipe \\.\pipe\filebeat.
+func PipePath(u *url.URL) string {
+	name := strings.TrimPrefix(u.Path, "/")
+	return `\\.\pipe\` + strings.Replace(name, "/", `\`, -1)
+}
+
+// LoadFile parses the given YAML file into a Config.
+func LoadFile(filename string) (*Config, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := Load(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", filename, err)
+	}
+	return cfg, nil
+}
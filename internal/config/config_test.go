@@ -0,0 +1,70 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseURI(t *testing.T) {
+	tests := []struct {
+		uri      string
+		host     string
+		hostname string
+		port     string
+	}{
+		{"http://localhost:5066", "localhost:5066", "localhost", "5066"},
+		{"http://[::1]:5066", "[::1]:5066", "::1", "5066"},
+		{"http://[::1]", "[::1]", "::1", ""},
+		{"https://[2001:db8::1]:5066", "[2001:db8::1]:5066", "2001:db8::1", "5066"},
+		{"http://[fe80::1%25eth0]:5066", "[fe80::1%eth0]:5066", "fe80::1%eth0", "5066"},
+		{"http://[fe80::1%eth0]:5066", "[fe80::1%eth0]:5066", "fe80::1%eth0", "5066"},
+		{"http://[fe80::1%eth0]", "[fe80::1%eth0]", "fe80::1%eth0", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.uri, func(t *testing.T) {
+			u, err := ParseURI(test.uri)
+			if err != nil {
+				t.Fatalf("ParseURI(%q) failed: %v", test.uri, err)
+			}
+			if u.Host != test.host || u.Hostname() != test.hostname || u.Port() != test.port {
+				t.Errorf("ParseURI(%q) = host %q, hostname %q, port %q, want %q, %q, %q",
+					test.uri, u.Host, u.Hostname(), u.Port(), test.host, test.hostname, test.port)
+			}
+		})
+	}
+}
+
+func TestValidateURI(t *testing.T) {
+	tests := []struct {
+		uri string
+		// err is a part of the expected error, "" if the URI is valid.
+		err string
+	}{
+		{"http://localhost:5066", ""},
+		{"http://[::1]:5066", ""},
+		{"http://[fe80::1%25eth0]:5066", ""},
+		{"http://[fe80::1%eth0]:5066", ""},
+		{"unix:///var/run/filebeat.sock", ""},
+		{"npipe:///filebeat", ""},
+		{"[::1]:5066", "missing scheme"},
+		{"fe80::1%eth0", "missing scheme"},
+		{"localhost:5066", "missing scheme"},
+		{"http://", "missing host"},
+		{"unix://", "missing socket path"},
+		{"npipe:///", "missing pipe name"},
+		{"ftp://[::1]:5066", "unsupported scheme"},
+	}
+	for _, test := range tests {
+		t.Run(test.uri, func(t *testing.T) {
+			err := ValidateURI(test.uri)
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("ValidateURI(%q) failed: %v", test.uri, err)
+			case test.err != "" && err == nil:
+				t.Errorf("ValidateURI(%q) succeeded, want error %q", test.uri, test.err)
+			case test.err != "" && !strings.Contains(err.Error(), test.err):
+				t.Errorf("ValidateURI(%q) = %v, want error %q", test.uri, err, test.err)
+			}
+		})
+	}
+}
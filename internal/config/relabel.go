@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// Relabel actions, with the semantics of Prometheus metric_relabel_configs.
+const (
+	RelabelReplace   = "replace"
+	RelabelKeep      = "keep"
+	RelabelDrop      = "drop"
+	RelabelLabelDrop = "labeldrop"
+	RelabelLabelKeep = "labelkeep"
+)
+
+// RelabelConfig is a rule rewriting or filtering the series exposed by the
+// exporter. The metric name is available as the __name__ label.
+type RelabelConfig struct {
+	SourceLabels []string `yaml:"source_labels,flow,omitempty"`
+	Separator    string   `yaml:"separator,omitempty"`
+	Regex        Regexp   `yaml:"regex,omitempty"`
+	TargetLabel  string   `yaml:"target_label,omitempty"`
+	Replacement  string   `yaml:"replacement,omitempty"`
+	Action       string   `yaml:"action,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler, filling in the defaults of
+// Prometheus for unset fields.
+func (c *RelabelConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = RelabelConfig{
+		Separator:   ";",
+		Regex:       MustNewRegexp("(.*)"),
+		Replacement: "$1",
+		Action:      RelabelReplace,
+	}
+	type plain RelabelConfig
+	return unmarshal((*plain)(c))
+}
+
+// Validate checks the semantic correctness of the rule.
+func (c *RelabelConfig) Validate() error {
+	for _, name := range c.SourceLabels {
+		if !model.LabelName(name).IsValid() {
+			return fmt.Errorf("invalid source label %q", name)
+		}
+	}
+	switch c.Action {
+	case RelabelReplace:
+		if c.TargetLabel == "" {
+			return fmt.Errorf("relabel action %s requires target_label", c.Action)
+		}
+	case RelabelKeep, RelabelDrop, RelabelLabelDrop, RelabelLabelKeep:
+	default:
+		return fmt.Errorf("unknown relabel action %q", c.Action)
+	}
+	return nil
+}
+
+// NameFilter returns a rule keeping, or with drop set dropping, the series
+// whose metric name matches any of the glob patterns, in which * matches any
+// run of characters and ? a single character.
+func NameFilter(patterns []string, drop bool) RelabelConfig {
+	exprs := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		expr := regexp.QuoteMeta(pattern)
+		expr = strings.Replace(expr, `\*`, ".*", -1)
+		expr = strings.Replace(expr, `\?`, ".", -1)
+		exprs[i] = expr
+	}
+	action := RelabelKeep
+	if drop {
+		action = RelabelDrop
+	}
+	return RelabelConfig{
+		SourceLabels: []string{model.MetricNameLabel},
+		Regex:        MustNewRegexp(strings.Join(exprs, "|")),
+		Action:       action,
+	}
+}
+
+// Regexp is a regular expression anchored at both ends, as in Prometheus.
+type Regexp struct {
+	*regexp.Regexp
+}
+
+// NewRegexp compiles the anchored form of expr.
+func NewRegexp(expr string) (Regexp, error) {
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return Regexp{}, err
+	}
+	return Regexp{Regexp: re}, nil
+}
+
+// MustNewRegexp is like NewRegexp but panics if expr doesn't compile.
+func MustNewRegexp(expr string) Regexp {
+	re, err := NewRegexp(expr)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (re *Regexp) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var expr string
+	if err := unmarshal(&expr); err != nil {
+		return err
+	}
+	compiled, err := NewRegexp(expr)
+	if err != nil {
+		return fmt.Errorf("invalid regex %q: %w", expr, err)
+	}
+	*re = compiled
+	return nil
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeKeyPair writes a self-signed certificate and its key, encrypted with
+// passphrase unless it is empty, to dir.
+func writeKeyPair(t *testing.T, dir, passphrase string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "beat-exporter"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	if passphrase != "" {
+		if block, err = x509.EncryptPEMBlock(rand.Reader, block.Type, der, []byte(passphrase), x509.PEMCipherAES256); err != nil {
+			t.Fatal(err)
+		}
+	}
+	certFile, keyFile = filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestLoadKeyPair(t *testing.T) {
+	dir := t.TempDir()
+	passphraseFile := filepath.Join(dir, "passphrase")
+	if err := ioutil.WriteFile(passphraseFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	plainDir, encryptedDir := filepath.Join(dir, "plain"), filepath.Join(dir, "encrypted")
+	for _, d := range []string{plainDir, encryptedDir} {
+		if err := os.Mkdir(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	plainCert, plainKey := writeKeyPair(t, plainDir, "")
+	encryptedCert, encryptedKey := writeKeyPair(t, encryptedDir, "secret")
+
+	tests := []struct {
+		name    string
+		config  TLSConfig
+		wantErr bool
+	}{
+		{"plain key", TLSConfig{CertFile: plainCert, KeyFile: plainKey}, false},
+		{"plain key with passphrase", TLSConfig{CertFile: plainCert, KeyFile: plainKey, KeyPassphrase: "secret"}, false},
+		{"passphrase", TLSConfig{CertFile: encryptedCert, KeyFile: encryptedKey, KeyPassphrase: "secret"}, false},
+		{"passphrase file", TLSConfig{CertFile: encryptedCert, KeyFile: encryptedKey, KeyPassphraseFile: passphraseFile}, false},
+		{"wrong passphrase", TLSConfig{CertFile: encryptedCert, KeyFile: encryptedKey, KeyPassphrase: "wrong"}, true},
+		{"no passphrase", TLSConfig{CertFile: encryptedCert, KeyFile: encryptedKey}, true},
+		{"both passphrases", TLSConfig{CertFile: encryptedCert, KeyFile: encryptedKey, KeyPassphrase: "secret", KeyPassphraseFile: passphraseFile}, true},
+		{"passphrase without key", TLSConfig{KeyPassphrase: "secret"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateClientSettings(nil, test.config)
+			if (err != nil) != test.wantErr {
+				t.Errorf("err = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/trustpilot/beat-exporter/internal/config"
+)
+
+// AgentComponentLabel is the label holding the ID of an Elastic Agent
+// component, e.g. filebeat-default.
+const AgentComponentLabel = "component"
+
+// AgentDiscoverer lists the components run by Elastic Agents from their
+// monitoring endpoint and scrapes every component through the endpoint's
+// /processes/<id> proxy.
+type AgentDiscoverer struct {
+	endpoints       []string
+	refreshInterval time.Duration
+	client          *http.Client
+	sender          updateSender
+}
+
+// agentProcess is the subset of an entry of the /processes list used here.
+type agentProcess struct {
+	ID string `json:"id"`
+}
+
+// NewAgentDiscoverer returns a discoverer for the Elastic Agents with the
+// given monitoring endpoints, e.g. http://localhost:6791.
+func NewAgentDiscoverer(endpoints []string, refreshInterval time.Duration) (*AgentDiscoverer, error) {
+	for _, endpoint := range endpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid Elastic Agent monitoring endpoint %q", endpoint)
+		}
+	}
+	return &AgentDiscoverer{
+		endpoints:       endpoints,
+		refreshInterval: refreshInterval,
+		client:          &http.Client{Timeout: 30 * time.Second},
+		sender:          updateSender{source: "agent:" + strings.Join(endpoints, ",")},
+	}, nil
+}
+
+// Run implements Discoverer.
+func (d *AgentDiscoverer) Run(ctx context.Context, ch chan<- Update) {
+	ticker := time.NewTicker(d.refreshInterval)
+	defer ticker.Stop()
+
+	d.refresh(ctx, ch)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.refresh(ctx, ch)
+		}
+	}
+}
+
+// refresh lists the components of every Agent and sends their targets if
+// they changed. The previous targets of an Agent that can't be reached are
+// kept.
+func (d *AgentDiscoverer) refresh(ctx context.Context, ch chan<- Update) {
+	var targets []config.TargetConfig
+	for _, endpoint := range d.endpoints {
+		processes, err := d.listProcesses(ctx, endpoint)
+		if err != nil {
+			log.Errorf("Failed to list the components of Elastic Agent %s, keeping the current targets: %v", endpoint, err)
+			for _, tc := range d.sender.last {
+				if strings.HasPrefix(tc.URI, strings.TrimSuffix(endpoint, "/")+"/processes/") {
+					targets = append(targets, tc)
+				}
+			}
+			continue
+		}
+		for _, p := range processes {
+			tc := config.TargetConfig{
+				URI:    strings.TrimSuffix(endpoint, "/") + "/processes/" + url.PathEscape(p.ID),
+				Labels: map[string]string{AgentComponentLabel: p.ID},
+			}
+			if err := tc.Validate(); err != nil {
+				log.Warnf("Skipping component %s of Elastic Agent %s: %v", p.ID, endpoint, err)
+				continue
+			}
+			targets = append(targets, tc)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].URI < targets[j].URI })
+	d.sender.send(ctx, ch, targets)
+}
+
+func (d *AgentDiscoverer) listProcesses(ctx context.Context, endpoint string) ([]agentProcess, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(endpoint, "/")+"/processes", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var list struct {
+		Processes []agentProcess `json:"processes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode process list: %w", err)
+	}
+	return list.Processes, nil
+}
@@ -0,0 +1,130 @@
+package discovery
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/trustpilot/beat-exporter/internal/config"
+)
+
+// APIDiscoverer holds targets added at runtime through the admin API. When
+// a service discovery file is configured, changes are also written to it so
+// they survive a restart.
+type APIDiscoverer struct {
+	mu      sync.Mutex
+	targets map[string]config.TargetConfig
+	file    string
+	changed chan struct{}
+	sender  updateSender
+}
+
+// NewAPIDiscoverer returns an empty API discoverer persisting to file, if
+// it is not empty.
+func NewAPIDiscoverer(file string) *APIDiscoverer {
+	return &APIDiscoverer{
+		targets: make(map[string]config.TargetConfig),
+		file:    file,
+		changed: make(chan struct{}, 1),
+		sender:  updateSender{source: "api"},
+	}
+}
+
+// Add adds or replaces the target with the given URI and labels.
+func (d *APIDiscoverer) Add(uri string, labels map[string]string) error {
+	tc := config.TargetConfig{URI: uri, Labels: labels}
+	if err := tc.Validate(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.file != "" {
+		err := editGroups(d.file, func(groups []TargetGroup) []TargetGroup {
+			return append(removeFromGroups(groups, uri), TargetGroup{Targets: []string{uri}, Labels: labels})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	d.targets[uri] = tc
+	d.notify()
+	return nil
+}
+
+// Remove removes the target with the given URI, also from the service
+// discovery file. It reports whether the target was found.
+func (d *APIDiscoverer) Remove(uri string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, found := d.targets[uri]
+	if d.file != "" {
+		err := editGroups(d.file, func(groups []TargetGroup) []TargetGroup {
+			edited := removeFromGroups(groups, uri)
+			if countTargets(edited) != countTargets(groups) {
+				found = true
+			}
+			return edited
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	delete(d.targets, uri)
+	d.notify()
+	return found, nil
+}
+
+func (d *APIDiscoverer) notify() {
+	select {
+	case d.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Run implements Discoverer.
+func (d *APIDiscoverer) Run(ctx context.Context, ch chan<- Update) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.changed:
+			d.mu.Lock()
+			targets := make([]config.TargetConfig, 0, len(d.targets))
+			for _, tc := range d.targets {
+				targets = append(targets, tc)
+			}
+			d.mu.Unlock()
+
+			sort.Slice(targets, func(i, j int) bool { return targets[i].URI < targets[j].URI })
+			d.sender.send(ctx, ch, targets)
+		}
+	}
+}
+
+// removeFromGroups drops the URI from every group, and groups left empty.
+func removeFromGroups(groups []TargetGroup, uri string) []TargetGroup {
+	result := []TargetGroup{}
+	for _, group := range groups {
+		var targets []string
+		for _, target := range group.Targets {
+			if target != uri {
+				targets = append(targets, target)
+			}
+		}
+		if len(targets) > 0 {
+			group.Targets = targets
+			result = append(result, group)
+		}
+	}
+	return result
+}
+
+func countTargets(groups []TargetGroup) int {
+	n := 0
+	for _, group := range groups {
+		n += len(group.Targets)
+	}
+	return n
+}
@@ -0,0 +1,236 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	log "github.com/sirupsen/logrus"
+	"github.com/trustpilot/beat-exporter/internal/config"
+)
+
+const (
+	// consulWait is how long a blocking query waits for changes.
+	consulWait = 5 * time.Minute
+	// consulRetryInterval is the delay after a failed query.
+	consulRetryInterval = 10 * time.Second
+)
+
+// ConsulDiscoverer watches the instances of Consul catalog services with
+// blocking queries and turns every instance into a target.
+type ConsulDiscoverer struct {
+	server      url.URL
+	services    []string
+	token       string
+	passingOnly bool
+	scheme      string
+	client      *http.Client
+	sender      updateSender
+}
+
+// consulServiceEntry is the subset of a Consul health API entry used here.
+type consulServiceEntry struct {
+	Node struct {
+		Node    string `json:"Node"`
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		ID      string            `json:"ID"`
+		Service string            `json:"Service"`
+		Address string            `json:"Address"`
+		Port    int               `json:"Port"`
+		Meta    map[string]string `json:"Meta"`
+	} `json:"Service"`
+}
+
+// serviceTargets carries the current targets of a single Consul service.
+type serviceTargets struct {
+	service string
+	targets []config.TargetConfig
+}
+
+// NewConsulDiscoverer returns a discoverer for the given services of the
+// Consul agent at server. With passingOnly, only instances whose health
+// checks pass are scraped.
+func NewConsulDiscoverer(server string, services []string, token string, passingOnly bool, scheme string) (*ConsulDiscoverer, error) {
+	if !strings.Contains(server, "://") {
+		server = "http://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Consul server %q: %w", server, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid Consul server %q: unsupported scheme %q", server, u.Scheme)
+	}
+	if scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q, expected http or https", scheme)
+	}
+
+	return &ConsulDiscoverer{
+		server:      *u,
+		services:    services,
+		token:       token,
+		passingOnly: passingOnly,
+		scheme:      scheme,
+		client:      &http.Client{Timeout: consulWait + 30*time.Second},
+		sender:      updateSender{source: "consul:" + strings.Join(services, ",")},
+	}, nil
+}
+
+// Run implements Discoverer.
+func (d *ConsulDiscoverer) Run(ctx context.Context, ch chan<- Update) {
+	updates := make(chan serviceTargets)
+	for _, service := range d.services {
+		go d.watch(ctx, service, updates)
+	}
+
+	current := make(map[string][]config.TargetConfig)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case u := <-updates:
+			current[u.service] = u.targets
+
+			var targets []config.TargetConfig
+			for _, service := range d.services {
+				targets = append(targets, current[service]...)
+			}
+			d.sender.send(ctx, ch, targets)
+		}
+	}
+}
+
+// watch runs blocking queries for a single service and reports its targets
+// whenever the Consul index changes. Failed queries are retried and keep the
+// current targets.
+func (d *ConsulDiscoverer) watch(ctx context.Context, service string, updates chan<- serviceTargets) {
+	var index uint64
+	for {
+		entries, newIndex, err := d.query(ctx, service, index)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Errorf("Failed to query Consul service %s, keeping its current targets: %v", service, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(consulRetryInterval):
+			}
+			continue
+		}
+
+		// Consul may reset its index, in which case the watch starts over.
+		if newIndex < index {
+			newIndex = 0
+		}
+		if newIndex == index && index != 0 {
+			continue
+		}
+		index = newIndex
+
+		select {
+		case updates <- serviceTargets{service: service, targets: d.entryTargets(entries)}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *ConsulDiscoverer) query(ctx context.Context, service string, index uint64) ([]consulServiceEntry, uint64, error) {
+	u := d.server
+	u.Path = "/v1/health/service/" + url.PathEscape(service)
+	query := url.Values{}
+	if d.passingOnly {
+		query.Set("passing", "true")
+	}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", consulWait.String())
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if d.token != "" {
+		req.Header.Set("X-Consul-Token", d.token)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	newIndex, err := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid X-Consul-Index header: %w", err)
+	}
+	var entries []consulServiceEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode service entries: %w", err)
+	}
+	return entries, newIndex, nil
+}
+
+// entryTargets builds a target per service instance. Targets are named after
+// their address and carry the service metadata as labels.
+func (d *ConsulDiscoverer) entryTargets(entries []consulServiceEntry) []config.TargetConfig {
+	targets := make([]config.TargetConfig, 0, len(entries))
+	for _, e := range entries {
+		address := e.Service.Address
+		if address == "" {
+			address = e.Node.Address
+		}
+		hostPort := net.JoinHostPort(address, strconv.Itoa(e.Service.Port))
+
+		tc := config.TargetConfig{
+			Name:   hostPort,
+			URI:    d.scheme + "://" + hostPort,
+			Labels: metaLabels(e.Service.Meta),
+		}
+		if err := tc.Validate(); err != nil {
+			log.Warnf("Skipping Consul service instance %s on node %s: %v", e.Service.ID, e.Node.Node, err)
+			continue
+		}
+		targets = append(targets, tc)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].URI < targets[j].URI })
+	return targets
+}
+
+// metaLabels turns Consul service metadata into labels. Keys are sanitized
+// into valid label names; the target label is reserved for the target name.
+func metaLabels(meta map[string]string) map[string]string {
+	if len(meta) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(meta))
+	for key, value := range meta {
+		name := strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+				return r
+			}
+			return '_'
+		}, key)
+		if !model.LabelName(name).IsValid() || name == config.TargetLabel {
+			continue
+		}
+		labels[name] = value
+	}
+	return labels
+}
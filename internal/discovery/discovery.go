@@ -0,0 +1,62 @@
+package discovery
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/trustpilot/beat-exporter/internal/config"
+)
+
+// Update carries the complete, current list of targets found by a discoverer.
+type Update struct {
+	Source  string
+	Targets []config.TargetConfig
+}
+
+// Discoverer finds Beat targets dynamically. Run sends an Update whenever the
+// set of targets changes, until ctx is cancelled.
+type Discoverer interface {
+	Run(ctx context.Context, ch chan<- Update)
+}
+
+// TargetGroup is a set of targets sharing the same labels, in the format of
+// Prometheus file_sd files.
+type TargetGroup struct {
+	Targets []string          `yaml:"targets" json:"targets"`
+	Labels  map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+// targetsFromGroups flattens target groups into target configurations.
+func targetsFromGroups(groups []TargetGroup) ([]config.TargetConfig, error) {
+	var targets []config.TargetConfig
+	for _, group := range groups {
+		for _, uri := range group.Targets {
+			tc := config.TargetConfig{URI: uri, Labels: group.Labels}
+			if err := tc.Validate(); err != nil {
+				return nil, err
+			}
+			targets = append(targets, tc)
+		}
+	}
+	return targets, nil
+}
+
+// updateSender sends the targets of a discoverer, skipping updates that
+// don't change them.
+type updateSender struct {
+	source string
+	last   []config.TargetConfig
+	sent   bool
+}
+
+func (s *updateSender) send(ctx context.Context, ch chan<- Update, targets []config.TargetConfig) {
+	if s.sent && reflect.DeepEqual(targets, s.last) {
+		return
+	}
+	s.last, s.sent = targets, true
+
+	select {
+	case ch <- Update{Source: s.source, Targets: targets}:
+	case <-ctx.Done():
+	}
+}
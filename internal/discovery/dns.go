@@ -0,0 +1,127 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/trustpilot/beat-exporter/internal/config"
+)
+
+// DNSDiscoverer resolves SRV, A or AAAA records on an interval and turns
+// every record into a target.
+type DNSDiscoverer struct {
+	names           []string
+	queryType       string
+	port            int
+	scheme          string
+	refreshInterval time.Duration
+	resolver        *net.Resolver
+	sender          updateSender
+
+	// last holds the targets of every name, kept when a lookup fails.
+	last map[string][]config.TargetConfig
+}
+
+// NewDNSDiscoverer returns a discoverer for the given DNS names. SRV records
+// carry their own port; for A and AAAA records the given port is used.
+func NewDNSDiscoverer(names []string, queryType string, port int, scheme string, refreshInterval time.Duration) (*DNSDiscoverer, error) {
+	queryType = strings.ToUpper(queryType)
+	switch queryType {
+	case "SRV", "A", "AAAA":
+	default:
+		return nil, fmt.Errorf("unsupported DNS query type %q, expected one of SRV, A, AAAA", queryType)
+	}
+	if queryType != "SRV" && (port <= 0 || port > 65535) {
+		return nil, fmt.Errorf("a valid port is required for %s records", queryType)
+	}
+	if scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q, expected http or https", scheme)
+	}
+
+	return &DNSDiscoverer{
+		names:           names,
+		queryType:       queryType,
+		port:            port,
+		scheme:          scheme,
+		refreshInterval: refreshInterval,
+		resolver:        net.DefaultResolver,
+		sender:          updateSender{source: "dns:" + strings.Join(names, ",")},
+		last:            make(map[string][]config.TargetConfig),
+	}, nil
+}
+
+// Run implements Discoverer.
+func (d *DNSDiscoverer) Run(ctx context.Context, ch chan<- Update) {
+	ticker := time.NewTicker(d.refreshInterval)
+	defer ticker.Stop()
+
+	d.refresh(ctx, ch)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.refresh(ctx, ch)
+		}
+	}
+}
+
+// refresh resolves every name and sends the targets if they changed. A name
+// that fails to resolve keeps the targets of its last successful lookup.
+func (d *DNSDiscoverer) refresh(ctx context.Context, ch chan<- Update) {
+	var targets []config.TargetConfig
+	for _, name := range d.names {
+		nameTargets, err := d.lookup(ctx, name)
+		if err != nil {
+			log.Errorf("Failed to resolve %s record %s, keeping its current targets: %v", d.queryType, name, err)
+			nameTargets = d.last[name]
+		} else {
+			d.last[name] = nameTargets
+		}
+		targets = append(targets, nameTargets...)
+	}
+	d.sender.send(ctx, ch, targets)
+}
+
+// lookup resolves a single name. Targets are named after their host and port,
+// which ends up in the target label and keeps their metrics apart.
+func (d *DNSDiscoverer) lookup(ctx context.Context, name string) ([]config.TargetConfig, error) {
+	var hostPorts []string
+	switch d.queryType {
+	case "SRV":
+		_, records, err := d.resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range records {
+			host := strings.TrimSuffix(srv.Target, ".")
+			hostPorts = append(hostPorts, net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+		}
+	case "A", "AAAA":
+		network := "ip4"
+		if d.queryType == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := d.resolver.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			hostPorts = append(hostPorts, net.JoinHostPort(ip.String(), strconv.Itoa(d.port)))
+		}
+	}
+
+	targets := make([]config.TargetConfig, 0, len(hostPorts))
+	for _, hostPort := range hostPorts {
+		targets = append(targets, config.TargetConfig{
+			Name: hostPort,
+			URI:  d.scheme + "://" + hostPort,
+		})
+	}
+	return targets, nil
+}
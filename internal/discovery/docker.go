@@ -0,0 +1,210 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/trustpilot/beat-exporter/internal/config"
+)
+
+// Container labels read by the Docker discoverer.
+const (
+	DockerPortLabel   = "beat-exporter.port"
+	DockerSchemeLabel = "beat-exporter.scheme"
+)
+
+// DockerDiscoverer lists the containers of a Docker host carrying the
+// DockerPortLabel and scrapes the Beat inside each of them.
+type DockerDiscoverer struct {
+	host            string
+	network         string
+	refreshInterval time.Duration
+	client          *http.Client
+	baseURL         url.URL
+	sender          updateSender
+}
+
+// dockerContainer is the subset of the Docker API container list used here.
+type dockerContainer struct {
+	ID         string            `json:"Id"`
+	Names      []string          `json:"Names"`
+	Labels     map[string]string `json:"Labels"`
+	HostConfig struct {
+		NetworkMode string `json:"NetworkMode"`
+	} `json:"HostConfig"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// NewDockerDiscoverer returns a discoverer for the Docker daemon at host,
+// given as unix:///path/to/docker.sock or tcp://host:port. If network is set,
+// containers are scraped on their address in that network.
+func NewDockerDiscoverer(host, network string, refreshInterval time.Duration) (*DockerDiscoverer, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Docker host %q: %w", host, err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	baseURL := url.URL{Scheme: "http"}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		baseURL.Host = "docker"
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		}
+	case "tcp", "http":
+		baseURL.Host = u.Host
+	default:
+		return nil, fmt.Errorf("invalid Docker host %q: unsupported scheme %q", host, u.Scheme)
+	}
+
+	return &DockerDiscoverer{
+		host:            host,
+		network:         network,
+		refreshInterval: refreshInterval,
+		client:          &http.Client{Timeout: 30 * time.Second, Transport: transport},
+		baseURL:         baseURL,
+		sender:          updateSender{source: "docker:" + host},
+	}, nil
+}
+
+// Run implements Discoverer.
+func (d *DockerDiscoverer) Run(ctx context.Context, ch chan<- Update) {
+	ticker := time.NewTicker(d.refreshInterval)
+	defer ticker.Stop()
+
+	d.refresh(ctx, ch)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.refresh(ctx, ch)
+		}
+	}
+}
+
+// refresh lists the containers and sends their targets if they changed. If
+// the Docker API can't be reached the previous targets are kept.
+func (d *DockerDiscoverer) refresh(ctx context.Context, ch chan<- Update) {
+	containers, err := d.listContainers(ctx)
+	if err != nil {
+		log.Errorf("Failed to list Docker containers, keeping the current targets: %v", err)
+		return
+	}
+
+	var targets []config.TargetConfig
+	for _, c := range containers {
+		tc, err := d.containerTarget(c)
+		if err != nil {
+			log.Warnf("Skipping container %.12s: %v", c.ID, err)
+			continue
+		}
+		targets = append(targets, tc)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].URI < targets[j].URI })
+	d.sender.send(ctx, ch, targets)
+}
+
+func (d *DockerDiscoverer) listContainers(ctx context.Context) ([]dockerContainer, error) {
+	filters, err := json.Marshal(map[string][]string{"label": {DockerPortLabel}})
+	if err != nil {
+		return nil, err
+	}
+	u := d.baseURL
+	u.Path = "/containers/json"
+	u.RawQuery = url.Values{"filters": {string(filters)}}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, d.host)
+	}
+
+	var containers []dockerContainer
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("failed to decode container list: %w", err)
+	}
+	return containers, nil
+}
+
+// containerTarget builds the target of a container from its labels and
+// network settings. Targets are named after the container.
+func (d *DockerDiscoverer) containerTarget(c dockerContainer) (config.TargetConfig, error) {
+	port, err := strconv.Atoi(c.Labels[DockerPortLabel])
+	if err != nil || port <= 0 || port > 65535 {
+		return config.TargetConfig{}, fmt.Errorf("invalid %s label %q", DockerPortLabel, c.Labels[DockerPortLabel])
+	}
+	scheme := c.Labels[DockerSchemeLabel]
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	address, err := d.containerAddress(c)
+	if err != nil {
+		return config.TargetConfig{}, err
+	}
+
+	name := c.ID
+	if len(name) > 12 {
+		name = name[:12]
+	}
+	if len(c.Names) > 0 {
+		name = strings.TrimPrefix(c.Names[0], "/")
+	}
+
+	tc := config.TargetConfig{
+		Name: name,
+		URI:  scheme + "://" + net.JoinHostPort(address, strconv.Itoa(port)),
+	}
+	return tc, tc.Validate()
+}
+
+// containerAddress returns the IP address the container is reachable at.
+// Containers in the host network namespace are reached via localhost.
+func (d *DockerDiscoverer) containerAddress(c dockerContainer) (string, error) {
+	if c.HostConfig.NetworkMode == "host" {
+		return "127.0.0.1", nil
+	}
+	if d.network != "" {
+		if n, ok := c.NetworkSettings.Networks[d.network]; ok && n.IPAddress != "" {
+			return n.IPAddress, nil
+		}
+		return "", fmt.Errorf("not attached to network %q", d.network)
+	}
+
+	// Without a configured network, pick the first one by name for stable results.
+	names := make([]string, 0, len(c.NetworkSettings.Networks))
+	for name := range c.NetworkSettings.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if ip := c.NetworkSettings.Networks[name].IPAddress; ip != "" {
+			return ip, nil
+		}
+	}
+	return "", fmt.Errorf("no network address")
+}
@@ -0,0 +1,169 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"github.com/trustpilot/beat-exporter/internal/config"
+	"gopkg.in/yaml.v2"
+)
+
+// fileDebounce is how long the file must stay unchanged before it is re-read.
+const fileDebounce = 200 * time.Millisecond
+
+// FileDiscoverer reads targets from a JSON or YAML file of target groups and
+// re-reads it whenever the file changes.
+type FileDiscoverer struct {
+	path            string
+	refreshInterval time.Duration
+	sender          updateSender
+}
+
+// NewFileDiscoverer returns a discoverer for the given file. The file is also
+// re-read every refreshInterval in case change notifications get lost.
+func NewFileDiscoverer(path string, refreshInterval time.Duration) *FileDiscoverer {
+	path = filepath.Clean(path)
+	return &FileDiscoverer{
+		path:            path,
+		refreshInterval: refreshInterval,
+		sender:          updateSender{source: "file:" + path},
+	}
+}
+
+// Run implements Discoverer.
+func (d *FileDiscoverer) Run(ctx context.Context, ch chan<- Update) {
+	var events <-chan fsnotify.Event
+	var errors <-chan error
+
+	// Watch the directory rather than the file, so that files replaced by a
+	// rename (as config management tools do) keep being tracked.
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Errorf("Failed to create file watcher, falling back to polling %s: %v", d.path, err)
+	} else {
+		defer watcher.Close()
+		if err := watcher.Add(filepath.Dir(d.path)); err != nil {
+			log.Errorf("Failed to watch %s, falling back to polling: %v", d.path, err)
+		}
+		events, errors = watcher.Events, watcher.Errors
+	}
+
+	ticker := time.NewTicker(d.refreshInterval)
+	defer ticker.Stop()
+
+	// Editors write files in several steps, so a change is only read once
+	// the events for it settled down.
+	debounce := time.NewTimer(0)
+	<-debounce.C
+	defer debounce.Stop()
+
+	d.refresh(ctx, ch)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			if filepath.Clean(event.Name) == d.path {
+				debounce.Reset(fileDebounce)
+			}
+		case <-debounce.C:
+			d.refresh(ctx, ch)
+		case err := <-errors:
+			log.Errorf("File watcher error for %s: %v", d.path, err)
+		case <-ticker.C:
+			d.refresh(ctx, ch)
+		}
+	}
+}
+
+// refresh reads the file and sends its targets if they changed. A file that
+// can't be read or parsed is logged and the previous targets are kept.
+func (d *FileDiscoverer) refresh(ctx context.Context, ch chan<- Update) {
+	targets, err := d.readFile()
+	if err != nil {
+		log.Errorf("Failed to read service discovery file, keeping the current targets: %v", err)
+		return
+	}
+	d.sender.send(ctx, ch, targets)
+}
+
+func (d *FileDiscoverer) readFile() ([]config.TargetConfig, error) {
+	groups, err := readGroups(d.path)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := targetsFromGroups(groups)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target in %s: %w", d.path, err)
+	}
+	return targets, nil
+}
+
+func readGroups(path string) ([]TargetGroup, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is a subset of YAML, so both formats are parsed the same way.
+	var groups []TargetGroup
+	if err := yaml.UnmarshalStrict(content, &groups); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return groups, nil
+}
+
+// writeGroups replaces the file atomically, so that watchers never read a
+// partially written file. Files with a .json extension are written as JSON.
+func writeGroups(path string, groups []TargetGroup) error {
+	var content []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		content, err = json.MarshalIndent(groups, "", "  ")
+	} else {
+		content, err = yaml.Marshal(groups)
+	}
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode()
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// editGroups applies edit to the target groups of the file. A missing file
+// is treated as empty.
+func editGroups(path string, edit func([]TargetGroup) []TargetGroup) error {
+	groups, err := readGroups(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return writeGroups(path, edit(groups))
+}
@@ -0,0 +1,86 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/trustpilot/beat-exporter/internal/config"
+)
+
+// IsGlob reports whether the Beat URI is a unix:// URI containing glob
+// patterns. Other URIs are never globs, so that the brackets of IPv6
+// literals such as http://[::1]:5066 are left alone.
+func IsGlob(beatURI string) bool {
+	return strings.HasPrefix(beatURI, "unix://") && strings.ContainsAny(beatURI, "*?[")
+}
+
+// SocketGlobDiscoverer expands a unix:// URI glob into a target for every
+// matching Unix socket, re-expanding it on an interval.
+type SocketGlobDiscoverer struct {
+	pattern         string
+	refreshInterval time.Duration
+	sender          updateSender
+}
+
+// NewSocketGlobDiscoverer returns a discoverer for a URI such as
+// unix:///var/run/beats/*.sock.
+func NewSocketGlobDiscoverer(beatURI string, refreshInterval time.Duration) (*SocketGlobDiscoverer, error) {
+	if !strings.HasPrefix(beatURI, "unix://") {
+		return nil, fmt.Errorf("invalid beat URI %q: globs are only supported for unix:// URIs", beatURI)
+	}
+	pattern := strings.TrimPrefix(beatURI, "unix://")
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid beat URI %q: %w", beatURI, err)
+	}
+
+	return &SocketGlobDiscoverer{
+		pattern:         pattern,
+		refreshInterval: refreshInterval,
+		sender:          updateSender{source: "glob:" + beatURI},
+	}, nil
+}
+
+// Run implements Discoverer.
+func (d *SocketGlobDiscoverer) Run(ctx context.Context, ch chan<- Update) {
+	ticker := time.NewTicker(d.refreshInterval)
+	defer ticker.Stop()
+
+	d.refresh(ctx, ch)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.refresh(ctx, ch)
+		}
+	}
+}
+
+// refresh expands the glob and sends the matching sockets if they changed.
+// Targets are named after the socket file without its extension.
+func (d *SocketGlobDiscoverer) refresh(ctx context.Context, ch chan<- Update) {
+	matches, err := filepath.Glob(d.pattern)
+	if err != nil {
+		log.Errorf("Failed to expand %s: %v", d.pattern, err)
+		return
+	}
+
+	var targets []config.TargetConfig
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil || info.Mode()&os.ModeSocket == 0 {
+			continue
+		}
+		base := filepath.Base(match)
+		targets = append(targets, config.TargetConfig{
+			Name: strings.TrimSuffix(base, filepath.Ext(base)),
+			URI:  "unix://" + match,
+		})
+	}
+	d.sender.send(ctx, ch, targets)
+}
@@ -0,0 +1,24 @@
+package discovery
+
+import "testing"
+
+func TestIsGlob(t *testing.T) {
+	tests := []struct {
+		uri  string
+		glob bool
+	}{
+		{"unix:///var/run/beats/*.sock", true},
+		{"unix:///var/run/beats/filebeat-?.sock", true},
+		{"unix:///var/run/beats/[ab].sock", true},
+		{"unix:///var/run/filebeat.sock", false},
+		{"http://[::1]:5066", false},
+		{"http://[fe80::1%eth0]:5066", false},
+		{"http://[fe80::1%25eth0]:5066", false},
+		{"http://localhost:5066", false},
+	}
+	for _, test := range tests {
+		if got := IsGlob(test.uri); got != test.glob {
+			t.Errorf("IsGlob(%q) = %v, want %v", test.uri, got, test.glob)
+		}
+	}
+}
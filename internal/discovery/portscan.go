@@ -0,0 +1,152 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/trustpilot/beat-exporter/internal/config"
+)
+
+const (
+	// maxScanPorts limits the size of a port range to keep scans cheap.
+	maxScanPorts = 1024
+	// scanWorkers is the number of ports probed concurrently.
+	scanWorkers = 16
+	// scanTimeout is the time a port gets to answer a probe.
+	scanTimeout = time.Second
+)
+
+// PortScanDiscoverer probes a range of ports on a host for Beat HTTP
+// endpoints and turns every port answering with Beat info into a target.
+type PortScanDiscoverer struct {
+	host            string
+	first, last     int
+	refreshInterval time.Duration
+	client          *http.Client
+	sender          updateSender
+}
+
+// ParsePortRange parses a port range such as 5066-5099, or a single port.
+func ParsePortRange(s string) (int, int, error) {
+	parts := strings.SplitN(s, "-", 2)
+	first, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q", s)
+	}
+	last := first
+	if len(parts) == 2 {
+		if last, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, 0, fmt.Errorf("invalid port range %q", s)
+		}
+	}
+	if first <= 0 || last > 65535 || first > last {
+		return 0, 0, fmt.Errorf("invalid port range %q", s)
+	}
+	if last-first+1 > maxScanPorts {
+		return 0, 0, fmt.Errorf("port range %q is larger than %d ports", s, maxScanPorts)
+	}
+	return first, last, nil
+}
+
+// NewPortScanDiscoverer returns a discoverer scanning the given port range
+// on host.
+func NewPortScanDiscoverer(host, portRange string, refreshInterval time.Duration) (*PortScanDiscoverer, error) {
+	first, last, err := ParsePortRange(portRange)
+	if err != nil {
+		return nil, err
+	}
+	return &PortScanDiscoverer{
+		host:            host,
+		first:           first,
+		last:            last,
+		refreshInterval: refreshInterval,
+		client:          &http.Client{Timeout: scanTimeout},
+		sender:          updateSender{source: "scan:" + net.JoinHostPort(host, portRange)},
+	}, nil
+}
+
+// Run implements Discoverer.
+func (d *PortScanDiscoverer) Run(ctx context.Context, ch chan<- Update) {
+	ticker := time.NewTicker(d.refreshInterval)
+	defer ticker.Stop()
+
+	d.refresh(ctx, ch)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.refresh(ctx, ch)
+		}
+	}
+}
+
+// refresh probes every port of the range and sends the Beats found if they
+// changed. Targets are named after their host and port.
+func (d *PortScanDiscoverer) refresh(ctx context.Context, ch chan<- Update) {
+	ports := make(chan int)
+	found := make([]bool, d.last-d.first+1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < scanWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for port := range ports {
+				found[port-d.first] = d.probe(ctx, port)
+			}
+		}()
+	}
+	for port := d.first; port <= d.last; port++ {
+		ports <- port
+	}
+	close(ports)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	var targets []config.TargetConfig
+	for i, ok := range found {
+		if !ok {
+			continue
+		}
+		hostPort := net.JoinHostPort(d.host, strconv.Itoa(d.first+i))
+		targets = append(targets, config.TargetConfig{Name: hostPort, URI: "http://" + hostPort})
+	}
+	d.sender.send(ctx, ch, targets)
+}
+
+// probe reports whether a Beat answers on the port with valid Beat info.
+func (d *PortScanDiscoverer) probe(ctx context.Context, port int) bool {
+	url := "http://" + net.JoinHostPort(d.host, strconv.Itoa(port)) + "/"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+
+	var info struct {
+		Beat    string `json:"beat"`
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return false
+	}
+	return info.Beat != "" && info.Version != ""
+}
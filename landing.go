@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+	"github.com/trustpilot/beat-exporter/internal/config"
+)
+
+// indexFuncs are the functions available to landing page templates.
+var indexFuncs = template.FuncMap{
+	"since": func(t time.Time) string { return time.Since(t).Round(time.Second).String() },
+}
+
+// indexTemplate renders the default landing page, listing every target with
+// the result of its last scrape.
+var indexTemplate = template.Must(template.New("index").Funcs(indexFuncs).Parse(`<html>
+	<head>
+		<title>Beat Exporter</title>
+		<style>
+			table { border-collapse: collapse; }
+			th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+			.up { color: #2a7d2a; }
+			.down { color: #c0392b; }
+			.pending, .unknown { color: #888; }
+		</style>
+	</head>
+	<body>
+		<h1>Beat Exporter</h1>
+		<p>
+			<a href='{{.MetricsPath}}'>Metrics</a>
+		</p>
+		<h2>Targets</h2>
+		{{if .Targets}}
+		<table>
+			<tr><th>Target</th><th>Beat</th><th>Version</th><th>Status</th><th>Last scrape</th><th>Error</th><th></th></tr>
+			{{range .Targets}}
+			<tr>
+				<td>{{if .Name}}{{.Name}}<br>{{end}}{{.URI}}</td>
+				<td>{{.Beat}}</td>
+				<td>{{.Version}}</td>
+				<td class='{{.Status}}'>{{.Status}}</td>
+				<td>{{if .LastScrape}}{{since .LastScrape}} ago ({{printf "%.3f" .LastScrapeDuration}}s){{end}}</td>
+				<td>{{.LastError}}</td>
+				<td>{{if .Beat}}<a href='/targets/metrics?uri={{.URI}}'>Metrics</a>{{end}}</td>
+			</tr>
+			{{end}}
+		</table>
+		{{else}}
+		<p>No targets.</p>
+		{{end}}
+	</body>
+</html>
+`))
+
+// indexData is the data landing page templates are executed with.
+type indexData struct {
+	MetricsPath string
+	Targets     []targetStatus
+}
+
+// loadIndexTemplate parses the landing page template at path, or returns
+// the default one if path is empty.
+func loadIndexTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return indexTemplate, nil
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(indexFuncs).ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse landing page template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// indexHandler returns an HTTP handler that serves the landing page.
+func indexHandler(tmpl *template.Template, metricsPath string, targets *targetManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := indexData{MetricsPath: metricsPath, Targets: targets.Status()}
+		if err := tmpl.Execute(w, data); err != nil {
+			log.Errorf("Failed to render the landing page: %v", err)
+		}
+	}
+}
+
+// targetMetricsHandler serves the metrics of the single discovered target
+// given in the uri query parameter, relabeled with rules.
+func targetMetricsHandler(targets *targetManager, rules func() []config.RelabelConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		gatherer, ok := targets.Gatherer(r.URL.Query().Get("uri"))
+		if !ok {
+			http.Error(w, "Unknown target", http.StatusNotFound)
+			return
+		}
+		metricsHandler(relabelGatherer{gatherer, rules}, promhttp.HandlerOpts{
+			ErrorLog:      log.New(),
+			ErrorHandling: promhttp.ContinueOnError,
+		}).ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/trustpilot/beat-exporter/collector"
+	"github.com/trustpilot/beat-exporter/internal/config"
+	"github.com/trustpilot/beat-exporter/internal/discovery"
+)
+
+// targetLoader resolves the list of Beat targets from flags and the config file.
+type targetLoader struct {
+	configFile  string
+	beatURIs    string
+	beatURIsSet bool
+	timeout     time.Duration
+	collectors  map[string]bool
+	// labels are added to every target, unless it sets them itself.
+	labels map[string]string
+	// nameFilters are the rules of --collect.include and --collect.exclude,
+	// applied before those of the config file.
+	nameFilters []config.RelabelConfig
+
+	// basicAuthUsername and basicAuthPasswordFile are the default basic
+	// authentication credentials of targets without their own.
+	basicAuthUsername     string
+	basicAuthPasswordFile string
+
+	// serviceDiscovery is set when targets are discovered dynamically, in
+	// which case the --beat.uris default is not scraped implicitly.
+	serviceDiscovery bool
+
+	mu        sync.RWMutex
+	modules   map[string]config.ProbeModule
+	relabel   []config.RelabelConfig
+	beatTypes map[string]config.BeatTypeConfig
+	basicAuth *config.BasicAuth
+}
+
+// load returns the static targets to scrape. An explicitly set --beat.uris
+// (flag or environment) wins over targets from the config file, which in turn
+// win over the --beat.uris default.
+func (l *targetLoader) load() ([]config.TargetConfig, error) {
+	if err := l.loadBasicAuth(); err != nil {
+		return nil, err
+	}
+
+	var targets []config.TargetConfig
+	if l.configFile != "" {
+		cfg, err := config.LoadFile(l.configFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range cfg.Warnings {
+			log.WithFields(log.Fields{"file": l.configFile, "option": w.Option}).Warn(w.Message)
+		}
+		for name, beatType := range cfg.BeatTypes {
+			if err := validateBeatType(beatType.Type); err != nil {
+				return nil, fmt.Errorf("beat type %s: %w", name, err)
+			}
+		}
+		for name, module := range cfg.Modules {
+			for collector := range module.Collectors {
+				if _, ok := l.collectors[collector]; !ok {
+					return nil, fmt.Errorf("module %s: unknown collector %q", name, collector)
+				}
+			}
+		}
+		if !l.beatURIsSet {
+			targets = cfg.Targets
+		}
+
+		l.mu.Lock()
+		l.modules = cfg.Modules
+		l.relabel = cfg.MetricRelabelConfigs
+		l.beatTypes = cfg.BeatTypes
+		l.mu.Unlock()
+	}
+	if len(targets) == 0 && (l.beatURIsSet || !l.serviceDiscovery) {
+		for _, beatURI := range strings.Split(l.beatURIs, ",") {
+			if discovery.IsGlob(beatURI) {
+				continue
+			}
+			targets = append(targets, config.TargetConfig{URI: beatURI})
+		}
+	}
+	return l.withDefaults(targets)
+}
+
+// loadBasicAuth reads the default basic authentication password from its
+// file, so that rotated passwords are picked up on every reload.
+func (l *targetLoader) loadBasicAuth() error {
+	if l.basicAuthUsername == "" {
+		return nil
+	}
+	basicAuth := &config.BasicAuth{Username: l.basicAuthUsername}
+	if l.basicAuthPasswordFile != "" {
+		password, err := config.ReadSecretFile(l.basicAuthPasswordFile)
+		if err != nil {
+			return err
+		}
+		basicAuth.Password = password
+	}
+
+	l.mu.Lock()
+	l.basicAuth = basicAuth
+	l.mu.Unlock()
+	return nil
+}
+
+// module returns the probe module with the given name from the last loaded
+// config file.
+func (l *targetLoader) module(name string) (config.ProbeModule, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	module, ok := l.modules[name]
+	return module, ok
+}
+
+// relabelConfigs returns the metric relabeling rules of the last loaded
+// config file.
+func (l *targetLoader) relabelConfigs() []config.RelabelConfig {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if len(l.nameFilters) == 0 {
+		return l.relabel
+	}
+	return append(append([]config.RelabelConfig{}, l.nameFilters...), l.relabel...)
+}
+
+// beatTypeConfigs returns the custom Beat mapping of the last loaded config
+// file.
+func (l *targetLoader) beatTypeConfigs() map[string]config.BeatTypeConfig {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.beatTypes
+}
+
+// validateBeatType checks that custom Beats are mapped to a type with
+// collectors, or to the generic one.
+func validateBeatType(beatType string) error {
+	if beatType == "" || beatType == config.GenericBeatType {
+		return nil
+	}
+	for _, known := range collector.BeatTypes {
+		if beatType == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown type %q, must be %s or one of: %s", beatType, config.GenericBeatType, strings.Join(collector.BeatTypes, ", "))
+}
+
+// socketGlobs returns the URIs of an explicitly set --beat.uris that are
+// globs, to be expanded by service discovery instead of scraped directly.
+func (l *targetLoader) socketGlobs() []string {
+	if !l.beatURIsSet {
+		return nil
+	}
+	var globs []string
+	for _, beatURI := range strings.Split(l.beatURIs, ",") {
+		if discovery.IsGlob(beatURI) {
+			globs = append(globs, beatURI)
+		}
+	}
+	return globs
+}
+
+// withDefaults fills unset per-target settings from the flags.
+func (l *targetLoader) withDefaults(targets []config.TargetConfig) ([]config.TargetConfig, error) {
+	l.mu.RLock()
+	basicAuth := l.basicAuth
+	l.mu.RUnlock()
+	return l.fillDefaults(targets, basicAuth)
+}
+
+// withProbeDefaults is withDefaults for targets given to /probe, which
+// anyone reaching the exporter can point at any host. They get the
+// credentials of their module only, never the default ones.
+func (l *targetLoader) withProbeDefaults(targets []config.TargetConfig) ([]config.TargetConfig, error) {
+	return l.fillDefaults(targets, nil)
+}
+
+// fillDefaults fills unset per-target settings from the flags, with
+// basicAuth for the targets without credentials of their own.
+func (l *targetLoader) fillDefaults(targets []config.TargetConfig, basicAuth *config.BasicAuth) ([]config.TargetConfig, error) {
+	result := make([]config.TargetConfig, len(targets))
+	for i, target := range targets {
+		if target.Timeout == 0 {
+			target.Timeout = l.timeout
+		}
+		if target.BasicAuth == nil && !target.Headers.Has("Authorization") {
+			target.BasicAuth = basicAuth
+		}
+		collectors := make(map[string]bool, len(l.collectors))
+		for name, enabled := range target.Collectors {
+			if _, ok := l.collectors[name]; !ok {
+				return nil, fmt.Errorf("target %s: unknown collector %q", target.URI, name)
+			}
+			collectors[name] = enabled
+		}
+		for name, enabled := range l.collectors {
+			if _, ok := collectors[name]; !ok {
+				collectors[name] = enabled
+			}
+		}
+		target.Collectors = collectors
+		if len(l.labels) > 0 {
+			labels := make(map[string]string, len(l.labels)+len(target.Labels))
+			for name, value := range l.labels {
+				labels[name] = value
+			}
+			for name, value := range target.Labels {
+				labels[name] = value
+			}
+			target.Labels = labels
+		}
+		result[i] = target
+	}
+	return result, nil
+}
+
+// mergeTargets combines the static targets with those of every service
+// discovery source. When several sources list the same URI, static targets
+// win, followed by sources in name order. A target whose target label is
+// already taken by another URI is renamed with a numeric suffix, as the
+// metrics of both would otherwise have the same label sets.
+//
+// Under legacyNames only the first static target without name or target
+// label goes without the label; every other unnamed target, including all
+// discovered ones, gets its URI as target label.
+func mergeTargets(static []config.TargetConfig, dynamic map[string][]config.TargetConfig, legacyNames bool) []config.TargetConfig {
+	sources := make([]string, 0, len(dynamic))
+	for source := range dynamic {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	seen := make(map[string]bool)
+	names := make(map[string]bool)
+	unlabelled := false
+	var merged []config.TargetConfig
+	add := func(targets []config.TargetConfig, discovered bool) {
+		for _, tc := range targets {
+			if seen[tc.URI] {
+				continue
+			}
+			seen[tc.URI] = true
+			if _, ok := tc.Labels[config.TargetLabel]; legacyNames && tc.Name == "" && !ok {
+				if discovered || unlabelled {
+					labels := make(map[string]string, len(tc.Labels)+1)
+					for name, value := range tc.Labels {
+						labels[name] = value
+					}
+					labels[config.TargetLabel] = tc.URI
+					tc.Labels = labels
+				} else {
+					unlabelled = true
+				}
+			}
+			name := tc.ConstLabels()[config.TargetLabel]
+			if names[name] {
+				suffixed := name
+				for i := 2; names[suffixed]; i++ {
+					suffixed = fmt.Sprintf("%s-%d", name, i)
+				}
+				tc.Name, name = suffixed, suffixed
+			}
+			names[name] = true
+			merged = append(merged, tc)
+		}
+	}
+
+	add(static, false)
+	for _, source := range sources {
+		add(dynamic[source], true)
+	}
+	return merged
+}
+
+// validateConfig checks the config file, the resulting targets and the
+// listener settings without contacting any Beat.
+func validateConfig(loader *targetLoader, webCfg webConfig) error {
+	targets, err := loader.load()
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		if err := config.ValidateURI(target.URI); err != nil {
+			return err
+		}
+	}
+	for _, glob := range loader.socketGlobs() {
+		if _, err := discovery.NewSocketGlobDiscoverer(glob, time.Minute); err != nil {
+			return err
+		}
+	}
+	return webCfg.validate()
+}
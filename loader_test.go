@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/trustpilot/beat-exporter/internal/config"
+)
+
+func TestLoadBeatURIs(t *testing.T) {
+	loader := &targetLoader{
+		beatURIs:    "http://[::1]:5066,http://[fe80::1%eth0]:5066,unix:///var/run/beats/*.sock,http://localhost:5066",
+		beatURIsSet: true,
+	}
+	targets, err := loader.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var uris []string
+	for _, target := range targets {
+		if err := config.ValidateURI(target.URI); err != nil {
+			t.Error(err)
+		}
+		uris = append(uris, target.URI)
+	}
+	want := []string{"http://[::1]:5066", "http://[fe80::1%eth0]:5066", "http://localhost:5066"}
+	if !reflect.DeepEqual(uris, want) {
+		t.Errorf("targets = %q, want %q", uris, want)
+	}
+	if globs := loader.socketGlobs(); !reflect.DeepEqual(globs, []string{"unix:///var/run/beats/*.sock"}) {
+		t.Errorf("socket globs = %q, want the unix:// glob only", globs)
+	}
+}
+
+func TestMergeTargets(t *testing.T) {
+	static := []config.TargetConfig{{URI: "http://localhost:5066", Name: "filebeat"}}
+	dynamic := map[string][]config.TargetConfig{
+		"socket": {
+			{URI: "unix:///var/run/beats/filebeat.sock", Name: "filebeat"},
+			{URI: "http://localhost:5066", Name: "duplicate"},
+		},
+		"docker": {
+			{URI: "http://172.17.0.2:5066", Name: "filebeat"},
+			{URI: "http://172.17.0.3:5066", Name: "filebeat-2"},
+			{URI: "http://172.17.0.4:5066"},
+		},
+	}
+
+	var got []string
+	for _, tc := range mergeTargets(static, dynamic, false) {
+		got = append(got, tc.URI+" "+tc.ConstLabels()[config.TargetLabel])
+	}
+	want := []string{
+		"http://localhost:5066 filebeat",
+		"http://172.17.0.2:5066 filebeat-2",
+		"http://172.17.0.3:5066 filebeat-2-2",
+		"http://172.17.0.4:5066 http://172.17.0.4:5066",
+		"unix:///var/run/beats/filebeat.sock filebeat-3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged targets = %q, want %q", got, want)
+	}
+}
+
+func TestMergeTargetsLegacyNames(t *testing.T) {
+	static := []config.TargetConfig{
+		{URI: "http://localhost:5066"},
+		{URI: "http://localhost:5067"},
+		{URI: "http://localhost:5068", Name: "metricbeat"},
+	}
+	dynamic := map[string][]config.TargetConfig{
+		"file": {
+			{URI: "http://10.0.0.1:5066", Labels: map[string]string{"env": "prod"}},
+			{URI: "http://10.0.0.2:5066"},
+		},
+	}
+
+	var got []string
+	for _, tc := range mergeTargets(static, dynamic, true) {
+		got = append(got, tc.URI+" "+tc.Labels[config.TargetLabel])
+	}
+	want := []string{
+		"http://localhost:5066 ",
+		"http://localhost:5067 http://localhost:5067",
+		"http://localhost:5068 ",
+		"http://10.0.0.1:5066 http://10.0.0.1:5066",
+		"http://10.0.0.2:5066 http://10.0.0.2:5066",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged targets = %q, want %q", got, want)
+	}
+	if _, ok := dynamic["file"][0].Labels[config.TargetLabel]; ok {
+		t.Error("merging modified the labels of the discovered target")
+	}
+}
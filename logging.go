@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// configureLogging sets the global logrus level and formatter.
+func configureLogging(level, format string) error {
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(lvl)
+
+	switch format {
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{
+			FieldMap: log.FieldMap{
+				log.FieldKeyMsg: "message",
+			},
+		})
+	case "text":
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	case "logfmt":
+		log.SetFormatter(&log.TextFormatter{DisableColors: true, FullTimestamp: true})
+	default:
+		return fmt.Errorf("unknown log format %q, expected one of json, text, logfmt", format)
+	}
+	return nil
+}
+
+// kitLogger forwards the go-kit log lines of exporter-toolkit to logrus.
+type kitLogger struct{}
+
+func (kitLogger) Log(keyvals ...interface{}) error {
+	lvl := log.InfoLevel
+	msg := ""
+	fields := log.Fields{}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		key, value := fmt.Sprint(keyvals[i]), keyvals[i+1]
+		switch key {
+		case "level":
+			if l, err := log.ParseLevel(fmt.Sprint(value)); err == nil {
+				lvl = l
+			}
+		case "msg":
+			msg = fmt.Sprint(value)
+		default:
+			fields[key] = value
+		}
+	}
+	log.WithFields(fields).Log(lvl, msg)
+	return nil
+}
@@ -1,25 +1,28 @@
 package main
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
-	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/version"
 	log "github.com/sirupsen/logrus"
 	"github.com/trustpilot/beat-exporter/collector"
+	"github.com/trustpilot/beat-exporter/internal/config"
+	"github.com/trustpilot/beat-exporter/internal/discovery"
 )
 
 const (
@@ -28,136 +31,534 @@ const (
 
 func main() {
 	var (
-		listenAddress = flag.String("web.listen-address", ":9479", "Address to listen on for web interface and telemetry.")
-		tlsCertFile   = flag.String("tls.certfile", "", "TLS cert file for HTTPS.")
-		tlsKeyFile    = flag.String("tls.keyfile", "", "TLS key file for HTTPS.")
-		metricsPath   = flag.String("web.telemetry-path", "/metrics", "Path under which to expose metrics.")
-		beatURIs      = flag.String("beat.uris", "http://localhost:5066", "Comma-separated list of HTTP API addresses of Beats.")
-		beatTimeout   = flag.Duration("beat.timeout", 10*time.Second, "Timeout for trying to get stats from Beats.")
-		showVersion   = flag.Bool("version", false, "Show version and exit.")
-		systemBeat    = flag.Bool("beat.system", false, "Expose system stats.")
+		listenAddress     = flag.String("web.listen-address", ":9479", "Address to listen on for web interface and telemetry, or unix:///path/to/socket to listen on a Unix socket.")
+		socketMode        = flag.String("web.socket-mode", "0660", "Permissions of the Unix socket of --web.listen-address, in octal.")
+		tlsCertFile       = flag.String("tls.certfile", "", "TLS cert file for HTTPS.")
+		tlsKeyFile        = flag.String("tls.keyfile", "", "TLS key file for HTTPS.")
+		tlsMinVersion     = flag.String("tls.min-version", "TLS12", "Minimum TLS version accepted by the HTTPS listener. One of: TLS10, TLS11, TLS12, TLS13.")
+		tlsCiphers        = flag.String("tls.cipher-suites", "", "Comma-separated list of cipher suites allowed for TLS 1.2 and below, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Defaults to the Go defaults.")
+		tlsClientCA       = flag.String("tls.client-ca", "", "CA file used to verify client certificates. If set, clients must present a certificate signed by it.")
+		readHeaderTimeout = flag.Duration("web.read-header-timeout", 10*time.Second, "Maximum time to read the headers of a request. 0 disables the timeout.")
+		writeTimeout      = flag.Duration("web.write-timeout", 0, "Maximum time to read a request and write its response, including the scrape of every Beat. 0 disables the timeout.")
+		idleTimeout       = flag.Duration("web.idle-timeout", 2*time.Minute, "Maximum time to wait for the next request on a keep-alive connection. 0 disables the timeout.")
+		maxHeaderBytes    = flag.Int("web.max-header-bytes", http.DefaultMaxHeaderBytes, "Maximum size of the headers of a request, in bytes.")
+		enablePprof       = flag.Bool("web.enable-pprof", false, "Serve pprof profiles and expvar variables under /debug/ on --web.pprof-listen-address.")
+		pprofAddress      = flag.String("web.pprof-listen-address", "localhost:9480", "Address the pprof and expvar endpoints listen on.")
+		landingTemplate   = flag.String("web.landing-page-template", "", "Path to an html/template file replacing the landing page.")
+		disableLanding    = flag.Bool("web.disable-landing-page", false, "Don't serve the landing page. Requests to / return 404.")
+		maxRequests       = flag.Int("web.max-requests", 0, "Maximum number of concurrent scrapes of the metrics path. Scrapes beyond the limit are answered with 503. 0 means no limit.")
+		disableGzip       = flag.Bool("web.disable-compression", false, "Never compress responses, saving CPU at the cost of bandwidth.")
+		gzipLevel         = flag.Int("web.compression-level", gzip.DefaultCompression, "Gzip compression level of responses, from 1 (fastest) to 9 (smallest). -1 uses the default level.")
+		corsOrigins       = flag.String("web.cors-origins", "", "Comma-separated list of origins allowed to call the targets API, /targets/metrics and /probe from browsers, or * for any origin.")
+		timeoutOffset     = flag.Duration("web.scrape-timeout-offset", 500*time.Millisecond, "Time subtracted from the X-Prometheus-Scrape-Timeout-Seconds header of scrapes to leave room for the response. Requests to Beats are cancelled at the resulting deadline.")
+		accessLog         = flag.Bool("web.access-log", false, "Log every request served by the exporter, with its method, path, status, duration and remote address.")
+		allowedCIDRs      = flag.String("web.allowed-cidrs", "", "Comma-separated list of CIDRs, e.g. 10.0.0.0/8, allowed to reach the exporter. Requests from other addresses are rejected with 403. All addresses are allowed if empty.")
+		webConfigFile     = flag.String("web.config.file", "", "Path to an exporter-toolkit web configuration file that can enable TLS, client certificate or basic authentication.")
+		metricsPath       = flag.String("web.telemetry-path", "/metrics", "Path under which to expose metrics.")
+		beatURIs          = flag.String("beat.uris", "http://localhost:5066", "Comma-separated list of HTTP API addresses of Beats. unix:// addresses may be globs matching several sockets.")
+		basicAuthUser     = flag.String("beat.basic-auth-username", "", "Username sent with basic authentication to Beats without their own basic_auth setting, except probed ones.")
+		basicAuthPassFile = flag.String("beat.basic-auth-password-file", "", "Path to a file containing the password of --beat.basic-auth-username.")
+		beatTimeout       = flag.Duration("beat.timeout", 10*time.Second, "Default timeout for trying to get stats from Beats.")
+		scrapeRetries     = flag.Int("beat.scrape-retries", 0, "Number of times a stats request failing to connect to a Beat is retried within a scrape.")
+		scrapeBackoff     = flag.Duration("beat.scrape-retry-backoff", 100*time.Millisecond, "Delay before the first retry of a stats request, doubled after every further failure.")
+		scrapeJitter      = flag.Float64("beat.scrape-retry-jitter", 0.2, "Fraction of the retry delay, between 0 and 1, added at random.")
+		breakerFailures   = flag.Int("beat.circuit-breaker-failures", 0, "Number of consecutive failed scrapes after which requests to a Beat are skipped for --beat.circuit-breaker-cooldown. 0 disables the circuit breaker.")
+		breakerCooldown   = flag.Duration("beat.circuit-breaker-cooldown", 30*time.Second, "Time during which requests to a Beat are skipped once its circuit breaker opened.")
+		maxIdleConns      = flag.Int("beat.max-idle-conns-per-host", http.DefaultMaxIdleConnsPerHost, "Maximum number of idle connections kept open to each Beat.")
+		idleConnTimeout   = flag.Duration("beat.idle-conn-timeout", 90*time.Second, "Time after which idle connections to Beats are closed. 0 keeps them open.")
+		maxResponseBytes  = flag.Int64("beat.max-response-bytes", 10<<20, "Size in bytes above which responses of Beats are dropped, to protect the exporter from misbehaving endpoints. 0 disables the limit.")
+		ping              = flag.Bool("beat.ping", false, "Request the root endpoint of Beats on every scrape and export the outcome as beat_up.")
+		unknownFields     = flag.Bool("collect.unknown-fields", false, "Export the numeric fields of the Beat stats that no collector covers as untyped metrics named after their path, e.g. filebeat_libbeat_output_events_toomany.")
+		maxHarvesters     = flag.Int("collect.filebeat-harvesters-limit", 100, "Maximum number of files of each Filebeat exported by the filebeat-harvesters collector, by path. 0 disables the limit.")
+		perFile           = flag.Bool("collect.filebeat-harvesters-per-file", true, "Export the per-file metrics of the filebeat-harvesters collector. Only the totals over all files are exported if false.")
+		hashPaths         = flag.Bool("collect.filebeat-harvesters-hash-paths", false, "Label the files exported by the filebeat-harvesters collector with the SHA-256 of their path instead of the path.")
+		maxInputs         = flag.Int("collect.filebeat-inputs-limit", 100, "Maximum number of inputs of each Filebeat exported by the filebeat-inputs collector, by input ID. 0 disables the limit.")
+		latencyHistogram  = flag.Bool("beat.request-latency-histogram", false, "Export a histogram of the time until each Beat answers requests to its stats endpoint.")
+		durationHistogram = flag.Bool("beat.scrape-duration-histogram", false, "Export a histogram of the time taken to scrape each Beat along with the duration of the last scrape.")
+		reconnect         = flag.Bool("beat.resolve-every-scrape", false, "Reconnect to Beats on every scrape so their host names are resolved again, e.g. for Beats behind round-robin DNS or Kubernetes Services.")
+		disableKeepAlives = flag.Bool("beat.disable-keep-alives", false, "Open a new connection for every request to a Beat instead of reusing connections.")
+		showVersion       = flag.Bool("version", false, "Show version and exit.")
+		systemBeat        = flag.Bool("beat.system", false, "Expose system stats by default. Same as --collector.system.")
+		configFile        = flag.String("config.file", "", "Path to a YAML configuration file with Beat targets. Reloaded on SIGHUP.")
+		logLevel          = flag.String("log.level", "info", "Only log messages with the given severity or above. One of: debug, info, warn, error.")
+		logFormat         = flag.String("log.format", "json", "Output format of log messages. One of: json, text, logfmt.")
+		checkConfig       = flag.Bool("check-config", false, "Validate the configuration file and flags, then exit.")
+		requireAll        = flag.Bool("beat.require-all", false, "Exit with an error if any configured Beat cannot be discovered at startup.")
+		requireAny        = flag.Bool("beat.require-any", true, "Exit with an error if no configured Beat can be discovered at startup.")
+		dryRunMode        = flag.Bool("dry-run", false, "Discover every Beat, print the metrics that would be exposed, then exit.")
+		namespace         = flag.String("metrics.namespace", "", "Prefix added to the name of every metric collected from Beats, e.g. beat.")
+		staticLabels      = flag.String("metrics.labels", "", "Comma-separated list of name=value labels added to every metric collected from Beats, e.g. env=prod,team=logging. Labels of a target in the config file take precedence.")
+		collectInclude    = flag.String("collect.include", "", "Comma-separated list of glob patterns, e.g. *output*, of the metric names to expose. All metrics are exposed if empty.")
+		collectExclude    = flag.String("collect.exclude", "", "Comma-separated list of glob patterns of metric names not to expose, applied after --collect.include.")
+		legacyTypes       = flag.Bool("compat.legacy-types", false, "Export stats that only ever increase, such as events added, as gauges like earlier versions instead of counters.")
+		legacyNames       = flag.Bool("compat.legacy-names", false, "Export the metric names, labels and types of the original trustpilot/beat-exporter, such as filebeat_filebeat_events{event=\"active\"}, without the target label of unnamed targets. --dry-run lists the renamed series. Implies --compat.legacy-types.")
+		unifiedNamespace  = flag.Bool("metrics.unified-namespace", false, "Name the metrics of every Beat type beat_* with the type in a beat label, e.g. beat_events_active{beat=\"filebeat\"}, instead of filebeat_events_active.")
+		derivedMetrics    = flag.Bool("metrics.derived", false, "Export metrics derived from several stats of the Beats, such as the average number of events per output batch.")
+		cleanNames        = flag.Bool("metrics.clean-names", false, "Drop labels repeating the metric name, e.g. export filebeat_events_active instead of filebeat_events_events_active{event=\"active\"}. --dry-run lists the renamed series.")
+		beatNameLabel     = flag.Bool("metrics.beat-name-label", false, "Add the name reported by each Beat as beat_name label to its metrics.")
+		beatHostLabel     = flag.Bool("metrics.beat-host-label", false, "Add the host name reported by each Beat as beat_host label to its metrics.")
+		retryBackoff      = flag.Duration("beat.retry-backoff", 5*time.Second, "Initial delay before retrying the discovery of a Beat that could not be reached, doubled after every failure. 0 disables retries.")
+		retryMax          = flag.Duration("beat.retry-max-backoff", 5*time.Minute, "Maximum delay between discovery retries of a Beat.")
+		rediscovery       = flag.Duration("beat.rediscovery-interval", time.Minute, "Interval at which the identity of discovered Beats is checked for changes. 0 disables rediscovery.")
+		evictAfter        = flag.Int("beat.evict-after-failures", 0, "Number of consecutive failed scrapes after which a Beat is unregistered until it can be discovered again. 0 disables eviction.")
+		sdFile            = flag.String("beat.sd-file", "", "Path to a JSON or YAML file of target groups, in Prometheus file_sd format, that is watched for changes.")
+		sdRefresh         = flag.Duration("beat.sd-refresh-interval", 5*time.Minute, "Interval at which service discovery files are re-read even without change notifications.")
+		dnsSD             = flag.String("beat.dns-sd", "", "Comma-separated list of DNS names to resolve into Beat targets.")
+		dnsSDType         = flag.String("beat.dns-sd-type", "SRV", "Type of the DNS records to query. One of: SRV, A, AAAA.")
+		dnsSDPort         = flag.Int("beat.dns-sd-port", 5066, "Port of the Beat HTTP API for A and AAAA records.")
+		dnsSDScheme       = flag.String("beat.dns-sd-scheme", "http", "Scheme used to scrape Beats discovered through DNS. One of: http, https.")
+		dnsSDRefresh      = flag.Duration("beat.dns-sd-refresh-interval", 30*time.Second, "Interval at which DNS names are resolved again.")
+		dockerSD          = flag.Bool("beat.docker-sd", false, "Discover Beats in Docker containers labelled with beat-exporter.port.")
+		dockerHost        = flag.String("beat.docker-sd-host", "unix:///var/run/docker.sock", "Address of the Docker daemon used for container discovery.")
+		dockerNetwork     = flag.String("beat.docker-sd-network", "", "Docker network whose container addresses are scraped. Defaults to the first network of each container.")
+		dockerRefresh     = flag.Duration("beat.docker-sd-refresh-interval", 30*time.Second, "Interval at which Docker containers are listed again.")
+		consulSD          = flag.String("beat.consul-sd", "", "Comma-separated list of Consul services to discover Beats from.")
+		consulServer      = flag.String("beat.consul-sd-server", "localhost:8500", "Address of the Consul agent used for service discovery.")
+		consulToken       = flag.String("beat.consul-sd-token-file", "", "Path to a file containing the Consul ACL token.")
+		consulPassing     = flag.Bool("beat.consul-sd-passing-only", true, "Only scrape service instances whose health checks are passing.")
+		consulScheme      = flag.String("beat.consul-sd-scheme", "http", "Scheme used to scrape Beats discovered through Consul. One of: http, https.")
+		agentSD           = flag.String("beat.agent-sd", "", "Comma-separated list of Elastic Agent monitoring endpoints, e.g. http://localhost:6791, whose components are scraped.")
+		agentRefresh      = flag.Duration("beat.agent-sd-refresh-interval", 30*time.Second, "Interval at which the components of Elastic Agents are listed again.")
+		scanPorts         = flag.String("beat.scan-ports", "", "Port range, e.g. 5066-5099, probed on --beat.scan-host for Beats. Disabled if empty.")
+		scanHost          = flag.String("beat.scan-host", "localhost", "Host whose ports are probed for Beats.")
+		scanRefresh       = flag.Duration("beat.scan-refresh-interval", time.Minute, "Interval at which the port range is probed again.")
+		adminToken        = flag.String("web.admin-token-file", "", "Path to a file containing the bearer token of the admin API. The admin API is disabled if empty.")
+		adminPersist      = flag.Bool("web.admin-persist", false, "Write targets added or removed through the admin API to --beat.sd-file.")
+		readyTargets      = flag.Int("web.ready-min-targets", 1, "Number of discovered Beats required before /-/ready reports the exporter as ready.")
+		shardIndex        = flag.Int("shard.index", 0, "Index of this exporter among --shard.total replicas. Only the targets hashing to this index are scraped.")
+		shardTotal        = flag.Int("shard.total", 1, "Number of exporter replicas the targets are split between.")
+		globRefresh       = flag.Duration("beat.uris-glob-refresh-interval", 30*time.Second, "Interval at which unix:// globs in --beat.uris are expanded again.")
 	)
+	collectorFlags := make(map[string]*bool)
+	for name, enabled := range collector.DefaultCollectors {
+		collectorFlags[name] = flag.Bool("collector."+name, enabled, fmt.Sprintf("Enable the %s collector by default.", name))
+	}
 	flag.Parse()
 
+	explicitFlags, err := applyEnvOverrides(flag.CommandLine)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
 	if *showVersion {
 		fmt.Print(version.Print(serviceName))
 		os.Exit(0)
 	}
 
 	// Configure logging
-	log.SetLevel(log.InfoLevel)
-	log.SetFormatter(&log.JSONFormatter{
-		FieldMap: log.FieldMap{
-			log.FieldKeyMsg: "message",
+	if err := configureLogging(*logLevel, *logFormat); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	loader := &targetLoader{
+		configFile:  *configFile,
+		beatURIs:    *beatURIs,
+		beatURIsSet: explicitFlags["beat.uris"],
+		timeout:     *beatTimeout,
+		collectors:  make(map[string]bool),
+
+		basicAuthUsername:     *basicAuthUser,
+		basicAuthPasswordFile: *basicAuthPassFile,
+
+		serviceDiscovery: *sdFile != "" || *dnsSD != "" || *dockerSD || *consulSD != "" || *scanPorts != "" || *agentSD != "",
+	}
+	for name, enabled := range collectorFlags {
+		loader.collectors[name] = *enabled
+	}
+	if *systemBeat {
+		loader.collectors["system"] = true
+	}
+
+	if loader.labels, err = config.ParseLabels(*staticLabels); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --metrics.labels: %v\n", err)
+		os.Exit(2)
+	}
+
+	if *unifiedNamespace && *legacyNames {
+		fmt.Fprintln(os.Stderr, "--metrics.unified-namespace and --compat.legacy-names are mutually exclusive")
+		os.Exit(2)
+	}
+	if *cleanNames && *legacyNames {
+		fmt.Fprintln(os.Stderr, "--metrics.clean-names and --compat.legacy-names are mutually exclusive")
+		os.Exit(2)
+	}
+	if *collectInclude != "" {
+		loader.nameFilters = append(loader.nameFilters, config.NameFilter(strings.Split(*collectInclude, ","), false))
+	}
+	if *collectExclude != "" {
+		loader.nameFilters = append(loader.nameFilters, config.NameFilter(strings.Split(*collectExclude, ","), true))
+	}
+
+	if *namespace != "" && !model.IsValidMetricName(model.LabelValue(*namespace)) {
+		fmt.Fprintf(os.Stderr, "invalid metrics namespace %q\n", *namespace)
+		os.Exit(2)
+	}
+
+	if *scrapeRetries < 0 || *scrapeBackoff < 0 || *scrapeJitter < 0 || *scrapeJitter > 1 {
+		fmt.Fprintln(os.Stderr, "--beat.scrape-retries and --beat.scrape-retry-backoff must not be negative, --beat.scrape-retry-jitter must be between 0 and 1")
+		os.Exit(2)
+	}
+	if *maxIdleConns < 0 || *idleConnTimeout < 0 {
+		fmt.Fprintln(os.Stderr, "--beat.max-idle-conns-per-host and --beat.idle-conn-timeout must not be negative")
+		os.Exit(2)
+	}
+	if *breakerFailures < 0 || *breakerCooldown < 0 {
+		fmt.Fprintln(os.Stderr, "--beat.circuit-breaker-failures and --beat.circuit-breaker-cooldown must not be negative")
+		os.Exit(2)
+	}
+	options := scrapeOptions{
+		namespace:     *namespace,
+		beatNameLabel: *beatNameLabel,
+		beatHostLabel: *beatHostLabel,
+		legacyNames:   *legacyNames,
+		beatTypes:     loader.beatTypeConfigs,
+		collector: collector.Options{
+			Retries:      *scrapeRetries,
+			RetryBackoff: *scrapeBackoff,
+			RetryJitter:  *scrapeJitter,
+
+			BreakerFailures: *breakerFailures,
+			BreakerCooldown: *breakerCooldown,
+
+			Reconnect:        *reconnect,
+			MaxResponseBytes: *maxResponseBytes,
+			Ping:             *ping,
+
+			DurationHistogram: *durationHistogram,
+			LatencyHistogram:  *latencyHistogram,
+			UnknownFields:     *unknownFields,
+			MaxInputs:         *maxInputs,
+			MaxHarvesters:     *maxHarvesters,
+			HashPaths:         *hashPaths,
+			PerFile:           *perFile,
+
+			Naming: collector.Naming{
+				UnifiedNamespace: *unifiedNamespace,
+				CleanNames:       *cleanNames,
+				LegacyNames:      *legacyNames,
+				LegacyTypes:      *legacyTypes,
+				DerivedMetrics:   *derivedMetrics,
+			},
+		},
+		transport: transportOptions{
+			maxIdleConnsPerHost: *maxIdleConns,
+			idleConnTimeout:     *idleConnTimeout,
+			disableKeepAlives:   *disableKeepAlives,
 		},
-	})
+	}
+
+	if *basicAuthPassFile != "" && *basicAuthUser == "" {
+		fmt.Fprintln(os.Stderr, "--beat.basic-auth-password-file requires --beat.basic-auth-username")
+		os.Exit(2)
+	}
 
-	// Parse the comma-separated list of Beat URIs
-	beatURLList := strings.Split(*beatURIs, ",")
+	if err := validateShard(*shardIndex, *shardTotal); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	webCfg := webConfig{
+		listenAddress: *listenAddress,
+		tlsCertFile:   *tlsCertFile,
+		tlsKeyFile:    *tlsKeyFile,
+		configFile:    *webConfigFile,
+
+		tlsMinVersion:   *tlsMinVersion,
+		tlsCipherSuites: *tlsCiphers,
+		tlsClientCA:     *tlsClientCA,
+		allowedCIDRs:    *allowedCIDRs,
+
+		readHeaderTimeout: *readHeaderTimeout,
+		writeTimeout:      *writeTimeout,
+		idleTimeout:       *idleTimeout,
+		maxHeaderBytes:    *maxHeaderBytes,
+
+		landingTemplate: *landingTemplate,
+	}
+	if mode, err := strconv.ParseUint(*socketMode, 8, 32); err != nil || mode > 0777 {
+		fmt.Fprintf(os.Stderr, "invalid --web.socket-mode %q, expected octal permissions such as 0660\n", *socketMode)
+		os.Exit(2)
+	} else {
+		webCfg.socketMode = os.FileMode(mode)
+	}
+	if _, err := webCfg.tlsConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if webCfg.tlsClientCA != "" && webCfg.tlsCertFile == "" {
+		fmt.Fprintln(os.Stderr, "--tls.client-ca requires --tls.certfile and --tls.keyfile")
+		os.Exit(2)
+	}
+	if *gzipLevel != gzip.DefaultCompression && (*gzipLevel < gzip.BestSpeed || *gzipLevel > gzip.BestCompression) {
+		fmt.Fprintf(os.Stderr, "invalid --web.compression-level %d, expected -1 or 1 to 9\n", *gzipLevel)
+		os.Exit(2)
+	}
+	allowedNetworks, err := webCfg.allowedNetworks()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if len(allowedNetworks) > 0 && webCfg.socketPath() != "" {
+		fmt.Fprintln(os.Stderr, "--web.allowed-cidrs can't be used with a Unix socket listen address")
+		os.Exit(2)
+	}
 
-	// Create a reusable HTTP client
-	httpClient := &http.Client{Timeout: *beatTimeout}
+	landing, err := loadIndexTemplate(webCfg.landingTemplate)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if *checkConfig {
+		if err := validateConfig(loader, webCfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration is invalid: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Configuration is valid")
+		os.Exit(0)
+	}
+
+	if *dryRunMode {
+		targetConfigs, err := loader.load()
+		if err != nil {
+			log.Fatalf("Failed to load targets: %v", err)
+		}
+		targetConfigs = shardTargets(targetConfigs, *shardIndex, *shardTotal)
+		if err := dryRun(os.Stdout, targetConfigs, options); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
 
 	// Setup signal handling for graceful shutdown
 	stopCh := make(chan os.Signal, 1)
 	signal.Notify(stopCh, syscall.SIGINT, syscall.SIGTERM)
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
 
 	// Prometheus registry
 	registry := prometheus.NewRegistry()
 	registry.MustRegister(version.NewCollector(serviceName))
 
 	// Discover Beat types
-	for _, beatURI := range beatURLList {
-		if err := discoverBeatType(httpClient, beatURI, registry, *systemBeat); err != nil {
-			log.Warnf("Failed to discover beat type at %s: %v", beatURI, err)
+	targetConfigs, err := loader.load()
+	if err != nil {
+		log.Fatalf("Failed to load targets: %v", err)
+	}
+	targets := newTargetManager(registry, options, *retryBackoff, *retryMax, *rediscovery, *evictAfter)
+	owned := shardTargets(mergeTargets(targetConfigs, nil, *legacyNames), *shardIndex, *shardTotal)
+	if *shardTotal > 1 {
+		log.Infof("Shard %d of %d owns %d of %d configured targets", *shardIndex, *shardTotal, len(owned), len(targetConfigs))
+	}
+	failed := targets.Sync(owned)
+	if len(failed) > 0 && *requireAll {
+		log.Fatalf("Failed to discover %d of %d beats: %s", len(failed), len(owned), strings.Join(failed, ", "))
+	}
+	if len(owned) > 0 && len(failed) == len(owned) && *requireAny {
+		log.Fatalf("None of the %d configured beats could be discovered, refusing to serve an empty endpoint", len(owned))
+	}
+
+	managerStop := make(chan struct{})
+	defer close(managerStop)
+	go targets.Run(managerStop)
+
+	// Start service discovery
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sdUpdates := make(chan discovery.Update)
+	var discoverers []discovery.Discoverer
+	if *sdFile != "" {
+		discoverers = append(discoverers, discovery.NewFileDiscoverer(*sdFile, *sdRefresh))
+	}
+	for _, glob := range loader.socketGlobs() {
+		d, err := discovery.NewSocketGlobDiscoverer(glob, *globRefresh)
+		if err != nil {
+			log.Fatalf("Invalid beat URI glob: %v", err)
+		}
+		discoverers = append(discoverers, d)
+	}
+	if *dnsSD != "" {
+		d, err := discovery.NewDNSDiscoverer(strings.Split(*dnsSD, ","), *dnsSDType, *dnsSDPort, *dnsSDScheme, *dnsSDRefresh)
+		if err != nil {
+			log.Fatalf("Invalid DNS service discovery settings: %v", err)
+		}
+		discoverers = append(discoverers, d)
+	}
+	if *dockerSD {
+		d, err := discovery.NewDockerDiscoverer(*dockerHost, *dockerNetwork, *dockerRefresh)
+		if err != nil {
+			log.Fatalf("Invalid Docker service discovery settings: %v", err)
+		}
+		discoverers = append(discoverers, d)
+	}
+	if *agentSD != "" {
+		d, err := discovery.NewAgentDiscoverer(strings.Split(*agentSD, ","), *agentRefresh)
+		if err != nil {
+			log.Fatalf("Invalid Elastic Agent discovery settings: %v", err)
 		}
+		discoverers = append(discoverers, d)
 	}
+	if *scanPorts != "" {
+		d, err := discovery.NewPortScanDiscoverer(*scanHost, *scanPorts, *scanRefresh)
+		if err != nil {
+			log.Fatalf("Invalid port scan settings: %v", err)
+		}
+		discoverers = append(discoverers, d)
+	}
+	if *consulSD != "" {
+		var token string
+		if *consulToken != "" {
+			if token, err = config.ReadSecretFile(*consulToken); err != nil {
+				log.Fatalf("Failed to read Consul token: %v", err)
+			}
+		}
+		d, err := discovery.NewConsulDiscoverer(*consulServer, strings.Split(*consulSD, ","), token, *consulPassing, *consulScheme)
+		if err != nil {
+			log.Fatalf("Invalid Consul service discovery settings: %v", err)
+		}
+		discoverers = append(discoverers, d)
+	}
+	var adminHandler http.Handler
+	if *adminToken != "" {
+		token, err := config.ReadSecretFile(*adminToken)
+		if err != nil {
+			log.Fatalf("Failed to read admin API token: %v", err)
+		}
+		if token == "" {
+			log.Fatal("The admin API token must not be empty")
+		}
+		var persistFile string
+		if *adminPersist {
+			if *sdFile == "" {
+				log.Fatal("--web.admin-persist requires --beat.sd-file")
+			}
+			persistFile = *sdFile
+		}
+		api := discovery.NewAPIDiscoverer(persistFile)
+		discoverers = append(discoverers, api)
+		adminHandler = requireToken(token, adminTargetsHandler(api))
+	}
+	for _, d := range discoverers {
+		go d.Run(ctx, sdUpdates)
+	}
+	discovered := make(map[string][]config.TargetConfig)
 
 	// Setup Prometheus metrics endpoint
-	http.Handle(*metricsPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{
-		ErrorLog:           log.New(),
-		DisableCompression: false,
-		ErrorHandling:      promhttp.ContinueOnError,
-	}))
+	mux := http.NewServeMux()
+	mux.Handle(*metricsPath, withScrapeDeadline(*timeoutOffset, metricsHandler(relabelGatherer{targets, loader.relabelConfigs}, promhttp.HandlerOpts{
+		ErrorLog:            log.New(),
+		DisableCompression:  false,
+		ErrorHandling:       promhttp.ContinueOnError,
+		MaxRequestsInFlight: *maxRequests,
+	})))
 
-	http.HandleFunc("/", indexHandler(*metricsPath))
+	var origins []string
+	if *corsOrigins != "" {
+		origins = strings.Split(*corsOrigins, ",")
+	}
+	mux.Handle("/api/v1/targets", apiHeaders(origins, targetsAPIHandler(targets, adminHandler)))
+	mux.Handle("/probe", apiHeaders(origins, withScrapeDeadline(*timeoutOffset, probeHandler(loader, options))))
+	mux.HandleFunc("/-/healthy", healthyHandler)
+	mux.HandleFunc("/-/ready", readyHandler(targets, *readyTargets))
+	mux.Handle("/targets/metrics", apiHeaders(origins, targetMetricsHandler(targets, loader.relabelConfigs)))
+	if !*disableLanding {
+		mux.Handle("/", indexHandler(landing, *metricsPath, targets))
+	}
 
 	// Start the server
-	go startHTTPServer(*listenAddress, *tlsCertFile, *tlsKeyFile)
-
-	<-stopCh
-	log.Info("Exporter stopped gracefully")
-}
+	var certs *certReloader
+	if webCfg.tlsCertFile != "" {
+		if certs, err = newCertReloader(webCfg.tlsCertFile, webCfg.tlsKeyFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var handler http.Handler = mux
+	if len(allowedNetworks) > 0 {
+		handler = allowNetworks(allowedNetworks, handler)
+	}
+	switch {
+	case *disableGzip:
+		handler = gzipHandler(gzip.NoCompression, handler)
+	case *gzipLevel != gzip.DefaultCompression:
+		handler = gzipHandler(*gzipLevel, handler)
+	}
+	if *accessLog {
+		handler = logAccess(handler)
+	}
+	go startHTTPServer(webCfg, certs, handler)
+	if *enablePprof {
+		go startDebugServer(*pprofAddress)
+	}
 
-// discoverBeatType attempts to load Beat info from a given URI and registers the collector if successful.
-func discoverBeatType(client *http.Client, beatURI string, registry *prometheus.Registry, systemBeat bool) error {
-	beatURL, err := url.Parse(beatURI)
-	if err != nil {
-		return fmt.Errorf("failed to parse beat URI: %w", err)
-	}
-
-	// Adjust transport for Unix socket
-	if beatURL.Scheme == "unix" {
-		unixPath := beatURL.Path
-		beatURL.Scheme = "http"
-		beatURL.Host = "localhost"
-		beatURL.Path = ""
-		client.Transport = &http.Transport{
-			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
-				return (&net.Dialer{}).DialContext(ctx, "unix", unixPath)
-			},
+	for {
+		select {
+		case <-reloadCh:
+			if certs != nil {
+				if err := certs.Reload(); err != nil {
+					log.Errorf("Failed to reload TLS certificate, keeping the current one: %v", err)
+				}
+			}
+			log.Info("Reloading targets")
+			reloaded, err := loader.load()
+			if err != nil {
+				log.Errorf("Failed to reload targets, keeping the current ones: %v", err)
+				continue
+			}
+			targetConfigs = reloaded
+			targets.Sync(shardTargets(mergeTargets(targetConfigs, discovered, *legacyNames), *shardIndex, *shardTotal))
+		case update := <-sdUpdates:
+			sdTargets, err := loader.withDefaults(update.Targets)
+			if err != nil {
+				log.Errorf("Invalid targets from %s: %v", update.Source, err)
+				continue
+			}
+			log.Infof("Service discovery %s found %d targets", update.Source, len(sdTargets))
+			discovered[update.Source] = sdTargets
+			targets.Sync(shardTargets(mergeTargets(targetConfigs, discovered, *legacyNames), *shardIndex, *shardTotal))
+		case <-stopCh:
+			log.Info("Exporter stopped gracefully")
+			return
 		}
 	}
+}
 
-	log.Infof("Trying to discover beat type at %s", beatURI)
-	beatInfo, err := loadBeatType(client, *beatURL)
+// discoverBeatType attempts to load Beat info for the given target and returns its collector if successful.
+// Custom Beats are scraped as mapped in beatTypes.
+func discoverBeatType(client *http.Client, beatURL *url.URL, target config.TargetConfig, beatTypes map[string]config.BeatTypeConfig, options collector.Options) (prometheus.Collector, *collector.BeatInfo, error) {
+	log.Infof("Trying to discover beat type at %s", target.URI)
+	beatInfo, err := loadBeatType(client, *beatURL, options.MaxResponseBytes)
 	if err != nil {
-		return err // If it fails, return the error
+		return nil, nil, err // If it fails, return the error
 	}
+	if beatType, ok := beatTypes[beatInfo.Beat]; ok {
+		beatInfo.Type, beatInfo.Namespace = beatType.Type, beatType.Namespace
+	}
+	beatInfo.Naming = options.Naming
 
-	// Register the collector for the discovered Beat
-	mainCollector := collector.NewMainCollector(client, beatURL, serviceName, beatInfo, systemBeat)
-	registry.MustRegister(mainCollector)
-
-	log.Infof("Beat type loaded successfully from %s", beatURI)
-	return nil
-}
+	options.RegistryPath = target.RegistryPath
 
-// indexHandler returns an HTTP handler that serves the index page.
-func indexHandler(metricsPath string) http.HandlerFunc {
-	indexHTML := `
-<html>
-	<head>
-		<title>Beat Exporter</title>
-	</head>
-	<body>
-		<h1>Beat Exporter</h1>
-		<p>
-			<a href='%s'>Metrics</a>
-		</p>
-	</body>
-</html>
-`
-	index := []byte(fmt.Sprintf(strings.TrimSpace(indexHTML), metricsPath))
-
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Write(index)
-	}
+	log.Infof("Beat type loaded successfully from %s", target.URI)
+	return collector.NewMainCollector(client, beatURL, serviceName, beatInfo, target.Collectors, options), beatInfo, nil
 }
 
 // loadBeatType fetches the Beat info from the provided URL.
-func loadBeatType(client *http.Client, url url.URL) (*collector.BeatInfo, error) {
-	response, err := client.Get(url.String())
+func loadBeatType(client *http.Client, url url.URL, maxResponseBytes int64) (*collector.BeatInfo, error) {
+	start := time.Now()
+	infoURL := collector.Endpoint(&url, "/")
+	response, err := client.Get(infoURL)
 	if err != nil {
 		return nil, err
 	}
 	defer response.Body.Close()
+	log.Debugf("GET %s returned %d in %s", infoURL, response.StatusCode, time.Since(start))
 
 	if response.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("received non-200 response: %d", response.StatusCode)
 	}
 
-	bodyBytes, err := io.ReadAll(response.Body)
+	bodyBytes, err := collector.ReadBody(response, maxResponseBytes)
 	if err != nil {
 		return nil, err
 	}
@@ -171,16 +572,19 @@ func loadBeatType(client *http.Client, url url.URL) (*collector.BeatInfo, error)
 	return &beatInfo, nil
 }
 
-// startHTTPServer starts the HTTP server for Prometheus metrics.
-func startHTTPServer(listenAddress, tlsCertFile, tlsKeyFile string) {
-	log.Infof("Starting exporter at %s", listenAddress)
-	if tlsCertFile != "" && tlsKeyFile != "" {
-		if err := http.ListenAndServeTLS(listenAddress, tlsCertFile, tlsKeyFile, nil); err != nil {
-			log.Fatalf("TLS server error: %v", err)
-		}
-	} else {
-		if err := http.ListenAndServe(listenAddress, nil); err != nil {
-			log.Fatalf("HTTP server error: %v", err)
+// healthyHandler reports that the exporter is alive.
+func healthyHandler(w http.ResponseWriter, _ *http.Request) {
+	fmt.Fprintln(w, "Healthy")
+}
+
+// readyHandler reports the exporter as ready once at least minTargets Beats
+// have been discovered.
+func readyHandler(targets *targetManager, minTargets int) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		if n := targets.Discovered(); n < minTargets {
+			http.Error(w, fmt.Sprintf("Not ready: %d of %d required beats discovered", n, minTargets), http.StatusServiceUnavailable)
+			return
 		}
+		fmt.Fprintln(w, "Ready")
 	}
 }
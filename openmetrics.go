@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/trustpilot/beat-exporter/collector"
+)
+
+// metricsHandler serves the metrics of the gatherer in the format negotiated
+// with the scraper, OpenMetrics included. opts.MaxRequestsInFlight applies to
+// both formats together. Gatherers implementing contextGatherer are bounded by
+// the context of the request, which carries the trace ID of a sampled W3C
+// traceparent header for exemplars.
+func metricsHandler(gatherer prometheus.Gatherer, opts promhttp.HandlerOpts) http.Handler {
+	var inFlight chan struct{}
+	if opts.MaxRequestsInFlight > 0 {
+		inFlight = make(chan struct{}, opts.MaxRequestsInFlight)
+		opts.MaxRequestsInFlight = 0
+	}
+	opts.EnableOpenMetrics = true
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inFlight != nil {
+			select {
+			case inFlight <- struct{}{}:
+				defer func() { <-inFlight }()
+			default:
+				http.Error(w, fmt.Sprintf("Limit of concurrent requests reached (%d), try again later.", cap(inFlight)), http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		g := gatherer
+		if cg, ok := gatherer.(contextGatherer); ok {
+			g = prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+				return cg.GatherContext(collector.ContextWithTraceParent(r.Context(), r.Header.Get("traceparent")))
+			})
+		}
+		if expfmt.NegotiateIncludingOpenMetrics(r.Header) == expfmt.FmtOpenMetrics {
+			g = counterTotalGatherer{g}
+		}
+		promhttp.HandlerFor(g, opts).ServeHTTP(w, r)
+	})
+}
+
+// contextGatherer is implemented by gatherers that can bound their gathering
+// by the context of the scrape.
+type contextGatherer interface {
+	GatherContext(ctx context.Context) ([]*dto.MetricFamily, error)
+}
+
+// counterTotalGatherer adds the _total suffix OpenMetrics requires to the
+// names of counters lacking it, which would otherwise be exposed as unknown.
+// The Prometheus text format keeps the names the exporter always had.
+//
+// A counter whose suffixed name is taken by another counter is merged into
+// it, keeping the series of the latter where both have the same labels, as
+// OpenMetrics names both families after the unsuffixed name. Next to a family
+// of another type it keeps its name and is exposed as unknown.
+type counterTotalGatherer struct {
+	prometheus.Gatherer
+}
+
+func (g counterTotalGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+
+	result := families[:0]
+	for _, family := range families {
+		if family.GetType() == dto.MetricType_COUNTER && !strings.HasSuffix(family.GetName(), "_total") {
+			name := family.GetName() + "_total"
+			existing, ok := byName[name]
+			switch {
+			case !ok:
+				family.Name = &name
+				byName[name] = family
+			case existing.GetType() == dto.MetricType_COUNTER:
+				mergeMetrics(existing, family)
+				continue
+			}
+		}
+		result = append(result, family)
+	}
+	return result, err
+}
+
+// mergeMetrics adds the metrics of from to those of into whose labels differ
+// from every metric of into.
+func mergeMetrics(into, from *dto.MetricFamily) {
+	seen := make(map[string]bool, len(into.Metric))
+	for _, metric := range into.Metric {
+		seen[labelsKey(metric)] = true
+	}
+	for _, metric := range from.Metric {
+		if !seen[labelsKey(metric)] {
+			into.Metric = append(into.Metric, metric)
+		}
+	}
+}
+
+// labelsKey identifies a metric of a family by its labels, which gatherers
+// return sorted by name.
+func labelsKey(metric *dto.Metric) string {
+	var key strings.Builder
+	for _, label := range metric.GetLabel() {
+		key.WriteString(label.GetName())
+		key.WriteByte(0)
+		key.WriteString(label.GetValue())
+		key.WriteByte(0)
+	}
+	return key.String()
+}
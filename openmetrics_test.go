@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// family returns a metric family of the given type with a metric per value
+// of the label target.
+func family(name string, metricType dto.MetricType, targets ...string) *dto.MetricFamily {
+	f := &dto.MetricFamily{Name: &name, Help: &name, Type: &metricType}
+	for _, target := range targets {
+		labelName, labelValue, value := "target", target, 1.0
+		metric := &dto.Metric{Label: []*dto.LabelPair{{Name: &labelName, Value: &labelValue}}}
+		switch metricType {
+		case dto.MetricType_COUNTER:
+			metric.Counter = &dto.Counter{Value: &value}
+		default:
+			metric.Gauge = &dto.Gauge{Value: &value}
+		}
+		f.Metric = append(f.Metric, metric)
+	}
+	return f
+}
+
+func TestCounterTotalGatherer(t *testing.T) {
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return []*dto.MetricFamily{
+			family("events", dto.MetricType_COUNTER, "a"),
+			family("events_total", dto.MetricType_COUNTER, "a", "b"),
+			family("writes", dto.MetricType_COUNTER, "a"),
+			family("reads", dto.MetricType_COUNTER, "a"),
+			family("reads_total", dto.MetricType_GAUGE, "a"),
+			family("active", dto.MetricType_GAUGE, "a"),
+		}, nil
+	})
+
+	families, err := counterTotalGatherer{gatherer}.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{
+		"events_total": 2,
+		"writes_total": 1,
+		"reads":        1,
+		"reads_total":  1,
+		"active":       1,
+	}
+	got := make(map[string]int)
+	for _, f := range families {
+		if _, ok := got[f.GetName()]; ok {
+			t.Errorf("family %s exposed twice", f.GetName())
+		}
+		got[f.GetName()] = len(f.GetMetric())
+	}
+	if len(got) != len(want) {
+		t.Errorf("families = %v, want %v", got, want)
+	}
+	for name, metrics := range want {
+		if got[name] != metrics {
+			t.Errorf("%s has %d metrics, want %d", name, got[name], metrics)
+		}
+	}
+
+	request := httptest.NewRequest("GET", "/metrics", nil)
+	request.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+	recorder := httptest.NewRecorder()
+	metricsHandler(gatherer, promhttp.HandlerOpts{}).ServeHTTP(recorder, request)
+	body, _ := ioutil.ReadAll(recorder.Body)
+	types := make(map[string]bool)
+	for _, line := range strings.Split(string(body), "\n") {
+		if !strings.HasPrefix(line, "# TYPE ") {
+			continue
+		}
+		name := strings.Fields(line)[2]
+		if types[name] {
+			t.Errorf("OpenMetrics family %s declared twice:\n%s", name, body)
+		}
+		types[name] = true
+	}
+	if !types["events"] || !types["writes"] {
+		t.Errorf("missing counters in:\n%s", body)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// dialPipe fails, as named pipes only exist on Windows.
+func dialPipe(_ context.Context, path string) (net.Conn, error) {
+	return nil, fmt.Errorf("cannot dial named pipe %s: named pipes are only supported on Windows", path)
+}
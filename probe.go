@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+	"github.com/trustpilot/beat-exporter/internal/config"
+)
+
+// probeHandler scrapes the Beat given in the target query parameter on
+// demand, in the style of the blackbox exporter, with the settings of the
+// probe module given in the module query parameter. Besides the Beat metrics it
+// exposes probe_success and probe_duration_seconds.
+func probeHandler(loader *targetLoader, options scrapeOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		beatURI := r.URL.Query().Get("target")
+		if beatURI == "" {
+			http.Error(w, "Target parameter is missing", http.StatusBadRequest)
+			return
+		}
+		if err := config.ValidateURI(beatURI); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var module config.ProbeModule
+		if name := r.URL.Query().Get("module"); name != "" {
+			var ok bool
+			if module, ok = loader.module(name); !ok {
+				http.Error(w, fmt.Sprintf("Unknown module %q", name), http.StatusBadRequest)
+				return
+			}
+		}
+
+		targets, err := loader.withProbeDefaults([]config.TargetConfig{module.Target(beatURI)})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tc := targets[0]
+		if deadline, ok := r.Context().Deadline(); ok {
+			if timeout := time.Until(deadline); timeout < tc.Timeout {
+				tc.Timeout = timeout
+			}
+		}
+
+		probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "probe_success",
+			Help: "Whether the Beat could be discovered.",
+		})
+		probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "probe_duration_seconds",
+			Help: "How long the discovery of the Beat took, in seconds.",
+		})
+
+		start := time.Now()
+		gatherers := prometheus.Gatherers{}
+		t, err := newTarget(tc, options)
+		probeDuration.Set(time.Since(start).Seconds())
+		if err != nil {
+			log.Warnf("Probe of %s failed: %v", beatURI, err)
+		} else {
+			probeSuccess.Set(1)
+			gatherers = append(gatherers, t.registry)
+		}
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(probeSuccess, probeDuration)
+		gatherers = append(gatherers, registry)
+
+		metricsHandler(relabelGatherer{gatherers, loader.relabelConfigs}, promhttp.HandlerOpts{
+			ErrorLog:      log.New(),
+			ErrorHandling: promhttp.ContinueOnError,
+		}).ServeHTTP(w, r)
+
+		if t != nil {
+			t.close()
+		}
+	}
+}
+
+// withScrapeDeadline bounds the context of requests by the scrape timeout
+// Prometheus sends along with every scrape, minus offset, so that the
+// exporter answers before Prometheus gives up on the scrape.
+func withScrapeDeadline(offset time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout, err := scrapeTimeout(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if timeout > 0 {
+			if timeout > offset {
+				timeout -= offset
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// scrapeTimeout returns the scrape timeout Prometheus sends along with every
+// scrape, or 0 if it is not set.
+func scrapeTimeout(r *http.Request) (time.Duration, error) {
+	header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if header == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid X-Prometheus-Scrape-Timeout-Seconds header %q", header)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
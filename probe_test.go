@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/trustpilot/beat-exporter/internal/config"
+)
+
+func TestProbeCredentials(t *testing.T) {
+	var mu sync.Mutex
+	var authorization []string
+	beat := fakeBeat(t, "filebeat")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		authorization = append(authorization, r.Header.Get("Authorization"))
+		mu.Unlock()
+		beat.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	loader := &targetLoader{
+		collectors: map[string]bool{},
+		basicAuth:  &config.BasicAuth{Username: "monitoring", Password: "secret"},
+		modules: map[string]config.ProbeModule{
+			"auth": {BasicAuth: &config.BasicAuth{Username: "probe", Password: "module"}},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"without module", "", ""},
+		{"with module", "&module=auth", "Basic cHJvYmU6bW9kdWxl"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authorization = nil
+			request := httptest.NewRequest("GET", "/probe?target="+server.URL+test.query, nil)
+			recorder := httptest.NewRecorder()
+			probeHandler(loader, scrapeOptions{}).ServeHTTP(recorder, request)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", recorder.Code, recorder.Body)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(authorization) == 0 {
+				t.Fatal("the Beat got no request")
+			}
+			for _, got := range authorization {
+				if got != test.want {
+					t.Errorf("Authorization = %q, want %q", got, test.want)
+				}
+			}
+		})
+	}
+}
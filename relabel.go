@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	log "github.com/sirupsen/logrus"
+	"github.com/trustpilot/beat-exporter/internal/config"
+)
+
+// relabelGatherer applies metric relabeling rules to the series of the
+// gatherer, so that irrelevant or high-cardinality series are dropped or
+// rewritten before exposition. The rules are looked up on every gather to
+// follow config reloads.
+type relabelGatherer struct {
+	prometheus.Gatherer
+	rules func() []config.RelabelConfig
+}
+
+func (g relabelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	return relabelFamilies(families, g.rules()), err
+}
+
+// GatherContext implements contextGatherer.
+func (g relabelGatherer) GatherContext(ctx context.Context) ([]*dto.MetricFamily, error) {
+	cg, ok := g.Gatherer.(contextGatherer)
+	if !ok {
+		return g.Gather()
+	}
+	families, err := cg.GatherContext(ctx)
+	return relabelFamilies(families, g.rules()), err
+}
+
+// relabelFamilies applies the rules to every metric of the families. Metrics
+// renamed through __name__ move to the family of their new name.
+func relabelFamilies(families []*dto.MetricFamily, rules []config.RelabelConfig) []*dto.MetricFamily {
+	if len(rules) == 0 {
+		return families
+	}
+
+	byName := make(map[string]*dto.MetricFamily)
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			labels := make(map[string]string, len(metric.Label)+1)
+			labels[model.MetricNameLabel] = family.GetName()
+			for _, pair := range metric.Label {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			if !relabel(labels, rules) {
+				continue
+			}
+
+			name := labels[model.MetricNameLabel]
+			if !model.IsValidMetricName(model.LabelValue(name)) {
+				log.Debugf("Dropping series of %s relabeled to invalid metric name %q", family.GetName(), name)
+				continue
+			}
+			target, ok := byName[name]
+			if !ok {
+				target = &dto.MetricFamily{Name: &name, Help: family.Help, Type: family.Type}
+				byName[name] = target
+			} else if target.GetType() != family.GetType() {
+				log.Debugf("Dropping series of %s relabeled to %s of another type", family.GetName(), name)
+				continue
+			}
+
+			delete(labels, model.MetricNameLabel)
+			metric.Label = labelPairs(labels)
+			target.Metric = append(target.Metric, metric)
+		}
+	}
+
+	result := make([]*dto.MetricFamily, 0, len(byName))
+	for _, family := range byName {
+		result = append(result, family)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GetName() < result[j].GetName() })
+	return result
+}
+
+// relabel applies the rules to the labels in place and reports whether the
+// series is kept.
+func relabel(labels map[string]string, rules []config.RelabelConfig) bool {
+	for _, rule := range rules {
+		values := make([]string, len(rule.SourceLabels))
+		for i, name := range rule.SourceLabels {
+			values[i] = labels[name]
+		}
+		value := strings.Join(values, rule.Separator)
+
+		switch rule.Action {
+		case config.RelabelKeep:
+			if !rule.Regex.MatchString(value) {
+				return false
+			}
+		case config.RelabelDrop:
+			if rule.Regex.MatchString(value) {
+				return false
+			}
+		case config.RelabelReplace:
+			match := rule.Regex.FindStringSubmatchIndex(value)
+			if match == nil {
+				continue
+			}
+			target := string(rule.Regex.ExpandString(nil, rule.TargetLabel, value, match))
+			if !model.LabelName(target).IsValid() {
+				continue
+			}
+			replacement := string(rule.Regex.ExpandString(nil, rule.Replacement, value, match))
+			if replacement == "" {
+				delete(labels, target)
+			} else {
+				labels[target] = replacement
+			}
+		case config.RelabelLabelDrop, config.RelabelLabelKeep:
+			// The metric name is never dropped.
+			for name := range labels {
+				if name != model.MetricNameLabel && rule.Regex.MatchString(name) == (rule.Action == config.RelabelLabelDrop) {
+					delete(labels, name)
+				}
+			}
+		}
+	}
+	return true
+}
+
+// labelPairs converts labels to the sorted label pairs of a metric.
+func labelPairs(labels map[string]string) []*dto.LabelPair {
+	pairs := make([]*dto.LabelPair, 0, len(labels))
+	for name, value := range labels {
+		name, value := name, value
+		pairs = append(pairs, &dto.LabelPair{Name: &name, Value: &value})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].GetName() < pairs[j].GetName() })
+	return pairs
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/trustpilot/beat-exporter/internal/config"
+)
+
+// validateShard checks the --shard.index and --shard.total flags.
+func validateShard(index, total int) error {
+	if total < 1 {
+		return fmt.Errorf("--shard.total must be at least 1")
+	}
+	if index < 0 || index >= total {
+		return fmt.Errorf("--shard.index must be between 0 and %d", total-1)
+	}
+	return nil
+}
+
+// shardTargets returns the targets owned by the shard with the given index.
+// Targets are assigned by a hash of their URI, so every replica configured
+// with the same target list and shard total picks a disjoint subset of it.
+func shardTargets(targets []config.TargetConfig, index, total int) []config.TargetConfig {
+	if total <= 1 {
+		return targets
+	}
+	var owned []config.TargetConfig
+	for _, tc := range targets {
+		h := fnv.New64a()
+		h.Write([]byte(tc.URI))
+		if h.Sum64()%uint64(total) == uint64(index) {
+			owned = append(owned, tc)
+		}
+	}
+	return owned
+}
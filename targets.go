@@ -0,0 +1,561 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+	"github.com/trustpilot/beat-exporter/collector"
+	"github.com/trustpilot/beat-exporter/internal/config"
+)
+
+// target is a discovered Beat together with the registry holding its collector.
+type target struct {
+	config    config.TargetConfig
+	options   scrapeOptions
+	info      *collector.BeatInfo
+	registry  *prometheus.Registry
+	collector prometheus.Collector
+	client    *http.Client
+}
+
+// gatherer returns the gatherer of the target for a scrape bounded by ctx.
+// Without a deadline the registry of the target is used as is; otherwise the
+// collector is registered for this scrape only, with the context of the
+// scrape, so that its requests to the Beat are cancelled at the deadline.
+func (t *target) gatherer(ctx context.Context) prometheus.Gatherer {
+	c, ok := t.collector.(collector.ContextCollector)
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline || !ok {
+		return t.registry
+	}
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		registry := prometheus.NewRegistry()
+		if err := targetRegisterer(registry, t.config, t.info, t.options).Register(contextCollector{c, ctx}); err != nil {
+			return nil, err
+		}
+		return registry.Gather()
+	})
+}
+
+// contextCollector collects a ContextCollector with a fixed context.
+type contextCollector struct {
+	collector.ContextCollector
+	ctx context.Context
+}
+
+func (c contextCollector) Collect(ch chan<- prometheus.Metric) {
+	c.CollectContext(c.ctx, ch)
+}
+
+// close releases the idle connections of a target that is no longer scraped.
+func (t *target) close() {
+	t.client.CloseIdleConnections()
+}
+
+// targetManager owns a registry per Beat target and swaps them in and out
+// when the target list changes. Targets get their own registry so that their
+// labels don't have to be consistent with each other.
+type targetManager struct {
+	mu       sync.RWMutex
+	registry *prometheus.Registry
+	options  scrapeOptions
+	targets  map[string]*target
+
+	// pending holds targets whose discovery failed and will be retried.
+	pending         map[string]*pendingTarget
+	retryBackoff    time.Duration
+	retryMaxBackoff time.Duration
+
+	rediscoveryInterval time.Duration
+
+	// evictAfter is the number of consecutive failed scrapes after which a
+	// target is evicted, 0 to never evict.
+	evictAfter int
+}
+
+// pendingTarget is a target waiting for its next discovery attempt.
+type pendingTarget struct {
+	config  config.TargetConfig
+	err     error
+	backoff time.Duration
+	nextTry time.Time
+}
+
+func newTargetManager(registry *prometheus.Registry, options scrapeOptions, retryBackoff, retryMaxBackoff, rediscoveryInterval time.Duration, evictAfter int) *targetManager {
+	return &targetManager{
+		registry:            registry,
+		options:             options,
+		targets:             make(map[string]*target),
+		pending:             make(map[string]*pendingTarget),
+		retryBackoff:        retryBackoff,
+		retryMaxBackoff:     retryMaxBackoff,
+		rediscoveryInterval: rediscoveryInterval,
+		evictAfter:          evictAfter,
+	}
+}
+
+// Gather implements prometheus.Gatherer.
+func (m *targetManager) Gather() ([]*dto.MetricFamily, error) {
+	return m.GatherContext(context.Background())
+}
+
+// GatherContext gathers the metrics of every target, cancelling requests to
+// Beats when ctx is done. Holding the read lock for the whole gather
+// guarantees a scrape never observes a half-applied target list. Targets are
+// gathered concurrently, so a slow Beat delays the scrape by at most its own
+// timeout instead of adding up with the other targets.
+func (m *targetManager) GatherContext(ctx context.Context) ([]*dto.MetricFamily, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	registries := []prometheus.Gatherer{m.registry}
+	for _, t := range m.targets {
+		registries = append(registries, t.gatherer(ctx))
+	}
+
+	gatherers := make(prometheus.Gatherers, len(registries))
+	var wg sync.WaitGroup
+	for i, registry := range registries {
+		wg.Add(1)
+		go func(i int, registry prometheus.Gatherer) {
+			defer wg.Done()
+			families, err := registry.Gather()
+			gatherers[i] = gathered{families, err}
+		}(i, registry)
+	}
+	wg.Wait()
+	return gatherers.Gather()
+}
+
+// gathered is a Gatherer returning the result of an earlier gather, used to
+// merge registries gathered concurrently.
+type gathered struct {
+	families []*dto.MetricFamily
+	err      error
+}
+
+func (g gathered) Gather() ([]*dto.MetricFamily, error) {
+	return g.families, g.err
+}
+
+// Gatherer returns the registry of the discovered target with the given URI.
+func (m *targetManager) Gatherer(beatURI string) (prometheus.Gatherer, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.targets[beatURI]
+	if !ok {
+		return nil, false
+	}
+	return t.registry, true
+}
+
+// Discovered returns the number of targets whose Beat has been discovered.
+func (m *targetManager) Discovered() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.targets)
+}
+
+// Sync reconciles the registered targets with the given target list.
+// Removed targets are dropped, and new or changed targets are discovered and
+// swapped in, in a single step. It returns the URIs of targets that could not
+// be discovered.
+func (m *targetManager) Sync(targetConfigs []config.TargetConfig) []string {
+	wanted := make(map[string]config.TargetConfig, len(targetConfigs))
+	for _, tc := range targetConfigs {
+		wanted[tc.URI] = tc
+	}
+
+	m.mu.RLock()
+	current := make(map[string]config.TargetConfig, len(m.targets))
+	for beatURI, t := range m.targets {
+		current[beatURI] = t.config
+	}
+	retrying := make(map[string]config.TargetConfig, len(m.pending))
+	for beatURI, p := range m.pending {
+		retrying[beatURI] = p.config
+	}
+	m.mu.RUnlock()
+
+	// Unchanged targets waiting for a retry are left to their backoff, so
+	// that frequent service discovery updates don't hammer unreachable Beats.
+	var changed, waiting []config.TargetConfig
+	for beatURI, tc := range wanted {
+		if old, ok := current[beatURI]; ok && reflect.DeepEqual(old, tc) {
+			continue
+		}
+		if old, ok := retrying[beatURI]; ok && reflect.DeepEqual(old, tc) {
+			waiting = append(waiting, tc)
+			continue
+		}
+		changed = append(changed, tc)
+	}
+
+	// Discover new and changed targets without holding the lock, so slow
+	// Beats don't block scrapes, and concurrently, so they don't add up.
+	results := make([]*target, len(changed))
+	errs := make([]error, len(changed))
+	var wg sync.WaitGroup
+	for i, tc := range changed {
+		wg.Add(1)
+		go func(i int, tc config.TargetConfig) {
+			defer wg.Done()
+			results[i], errs[i] = newTarget(tc, m.options)
+		}(i, tc)
+	}
+	wg.Wait()
+
+	discovered := make(map[string]*target)
+	failed := make(map[string]error)
+	for i, tc := range changed {
+		if errs[i] != nil {
+			log.Warnf("Failed to discover beat type at %s: %v", tc.URI, errs[i])
+			failed[tc.URI] = errs[i]
+			continue
+		}
+		discovered[tc.URI] = results[i]
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for beatURI, t := range m.targets {
+		if _, ok := wanted[beatURI]; !ok {
+			t.close()
+			delete(m.targets, beatURI)
+			log.Infof("Removed target %s", beatURI)
+		}
+	}
+
+	// Changed targets are replaced; if their rediscovery failed the old collector is kept.
+	for beatURI, t := range discovered {
+		if old, ok := m.targets[beatURI]; ok {
+			old.close()
+		}
+		m.targets[beatURI] = t
+	}
+
+	for beatURI := range m.pending {
+		if _, ok := wanted[beatURI]; !ok {
+			delete(m.pending, beatURI)
+		}
+	}
+	failedURIs := make([]string, 0, len(failed)+len(waiting))
+	for beatURI, err := range failed {
+		m.schedule(wanted[beatURI], err, m.pending[beatURI])
+		failedURIs = append(failedURIs, beatURI)
+	}
+	for _, tc := range waiting {
+		if _, ok := m.pending[tc.URI]; ok {
+			failedURIs = append(failedURIs, tc.URI)
+		}
+	}
+	sort.Strings(failedURIs)
+	return failedURIs
+}
+
+// schedule queues the target for another discovery attempt, doubling the
+// backoff of the previous attempt up to the configured maximum.
+func (m *targetManager) schedule(tc config.TargetConfig, err error, previous *pendingTarget) {
+	if m.retryBackoff <= 0 {
+		return
+	}
+	backoff := m.retryBackoff
+	if previous != nil {
+		backoff = previous.backoff * 2
+		if backoff > m.retryMaxBackoff {
+			backoff = m.retryMaxBackoff
+		}
+	}
+	m.pending[tc.URI] = &pendingTarget{config: tc, err: err, backoff: backoff, nextTry: time.Now().Add(backoff)}
+}
+
+// Run retries the discovery of failed targets and periodically checks the
+// identity of discovered targets until stop is closed.
+func (m *targetManager) Run(stop <-chan struct{}) {
+	retryTicker := time.NewTicker(time.Second)
+	defer retryTicker.Stop()
+
+	var rediscoveryC <-chan time.Time
+	if m.rediscoveryInterval > 0 {
+		rediscoveryTicker := time.NewTicker(m.rediscoveryInterval)
+		defer rediscoveryTicker.Stop()
+		rediscoveryC = rediscoveryTicker.C
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-retryTicker.C:
+			m.evictFailing()
+			m.retryDue(now)
+		case <-rediscoveryC:
+			m.rediscover()
+		}
+	}
+}
+
+// evictFailing unregisters targets that failed evictAfter consecutive
+// scrapes, so that their series go stale instead of being exported forever.
+// Evicted targets are queued for discovery like targets that were never
+// reachable, and come back once their Beat answers again.
+func (m *targetManager) evictFailing() {
+	if m.evictAfter <= 0 {
+		return
+	}
+
+	m.mu.RLock()
+	var failing []*target
+	for _, t := range m.targets {
+		if r, ok := t.collector.(collector.StatusReporter); ok && r.LastScrape().Failures >= m.evictAfter {
+			failing = append(failing, t)
+		}
+	}
+	m.mu.RUnlock()
+	if len(failing) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range failing {
+		if m.targets[t.config.URI] != t {
+			continue
+		}
+		last := t.collector.(collector.StatusReporter).LastScrape()
+		log.Warnf("Evicting target %s after %d failed scrapes: %v", t.config.URI, last.Failures, last.Err)
+		t.close()
+		delete(m.targets, t.config.URI)
+		m.schedule(t.config, last.Err, nil)
+	}
+}
+
+// retryDue attempts to discover every pending target whose backoff expired.
+func (m *targetManager) retryDue(now time.Time) {
+	m.mu.RLock()
+	var due []*pendingTarget
+	for _, p := range m.pending {
+		if !now.Before(p.nextTry) {
+			due = append(due, p)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, p := range due {
+		t, err := newTarget(p.config, m.options)
+
+		m.mu.Lock()
+		// The target list may have changed while discovering, drop stale results.
+		if current, ok := m.pending[p.config.URI]; !ok || current != p {
+			m.mu.Unlock()
+			if t != nil {
+				t.close()
+			}
+			continue
+		}
+		if err != nil {
+			m.schedule(p.config, err, p)
+			log.Warnf("Failed to discover beat type at %s, retrying in %s: %v", p.config.URI, m.pending[p.config.URI].backoff, err)
+		} else {
+			delete(m.pending, p.config.URI)
+			if old, ok := m.targets[p.config.URI]; ok {
+				old.close()
+			}
+			m.targets[p.config.URI] = t
+			log.Infof("Added target %s after retrying", p.config.URI)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// rediscover queries the info endpoint of every discovered target and
+// replaces its collector when the Beat behind it changed, e.g. because it was
+// restarted, upgraded or replaced by a different Beat type on the same port.
+func (m *targetManager) rediscover() {
+	m.mu.RLock()
+	current := make([]*target, 0, len(m.targets))
+	for _, t := range m.targets {
+		current = append(current, t)
+	}
+	m.mu.RUnlock()
+
+	for _, t := range current {
+		client, beatURL, err := newHTTPClient(t.config, t.options.transport)
+		if err != nil {
+			continue
+		}
+		info, err := loadBeatType(client, *beatURL, t.options.collector.MaxResponseBytes)
+		client.CloseIdleConnections()
+		if err != nil {
+			log.Debugf("Failed to check beat identity at %s: %v", t.config.URI, err)
+			continue
+		}
+		if info.Beat == t.info.Beat && info.Version == t.info.Version && info.EphemeralID == t.info.EphemeralID {
+			continue
+		}
+
+		log.Infof("Beat at %s changed from %s %s (%s) to %s %s (%s), re-registering",
+			t.config.URI, t.info.Beat, t.info.Version, t.info.EphemeralID, info.Beat, info.Version, info.EphemeralID)
+		replacement, err := newTarget(t.config, m.options)
+		if err != nil {
+			log.Warnf("Failed to rediscover beat type at %s: %v", t.config.URI, err)
+			continue
+		}
+
+		m.mu.Lock()
+		if m.targets[t.config.URI] == t {
+			t.close()
+			m.targets[t.config.URI] = replacement
+		} else {
+			replacement.close()
+		}
+		m.mu.Unlock()
+	}
+}
+
+// newTarget discovers the Beat of the given target and registers its
+// collector in a new registry, with the target's const labels and the metric
+// namespace of options applied.
+func newTarget(tc config.TargetConfig, options scrapeOptions) (*target, error) {
+	client, beatURL, err := newHTTPClient(tc, options.transport)
+	if err != nil {
+		return nil, err
+	}
+	var beatTypes map[string]config.BeatTypeConfig
+	if options.beatTypes != nil {
+		beatTypes = options.beatTypes()
+	}
+	c, info, err := discoverBeatType(client, beatURL, tc, beatTypes, options.collector)
+	if err != nil {
+		client.CloseIdleConnections()
+		return nil, err
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := targetRegisterer(registry, tc, info, options).Register(c); err != nil {
+		client.CloseIdleConnections()
+		return nil, fmt.Errorf("failed to register collector: %w", err)
+	}
+	return &target{config: tc, options: options, info: info, registry: registry, collector: c, client: client}, nil
+}
+
+// scrapeOptions holds the settings shared by every target.
+type scrapeOptions struct {
+	// namespace is prefixed to the name of every metric of the target.
+	namespace string
+	// beatNameLabel and beatHostLabel add the name and host name the Beat
+	// reports to every metric of the target.
+	beatNameLabel bool
+	beatHostLabel bool
+	// legacyNames leaves out the target label of unnamed targets, as the
+	// original exporter, which scraped a single Beat, did.
+	legacyNames bool
+	// beatTypes returns how to scrape custom Beats, by their name.
+	beatTypes func() map[string]config.BeatTypeConfig
+	collector collector.Options
+	transport transportOptions
+}
+
+// targetRegisterer wraps registry to add the labels of the target, and of
+// its Beat if enabled in options or by the unified namespace, and the
+// namespace to every metric.
+func targetRegisterer(registry *prometheus.Registry, tc config.TargetConfig, info *collector.BeatInfo, options scrapeOptions) prometheus.Registerer {
+	labels := tc.ConstLabels()
+	if _, ok := tc.Labels[config.TargetLabel]; options.legacyNames && tc.Name == "" && !ok {
+		delete(labels, config.TargetLabel)
+	}
+	if info.Naming.UnifiedNamespace {
+		labels["beat"] = info.Beat
+	}
+	if _, ok := labels["beat_name"]; options.beatNameLabel && !ok {
+		labels["beat_name"] = info.Name
+	}
+	if _, ok := labels["beat_host"]; options.beatHostLabel && !ok {
+		labels["beat_host"] = info.Hostname
+	}
+	registerer := prometheus.WrapRegistererWith(labels, registry)
+	if options.namespace != "" {
+		registerer = prometheus.WrapRegistererWithPrefix(options.namespace+"_", registerer)
+	}
+	return registerer
+}
+
+// targetStatus describes the discovery and scrape state of a target.
+type targetStatus struct {
+	URI                string            `json:"uri"`
+	Name               string            `json:"name,omitempty"`
+	Labels             map[string]string `json:"labels,omitempty"`
+	Beat               string            `json:"beat,omitempty"`
+	Version            string            `json:"version,omitempty"`
+	Status             string            `json:"status"`
+	LastScrape         *time.Time        `json:"last_scrape,omitempty"`
+	LastScrapeDuration float64           `json:"last_scrape_duration_seconds"`
+	LastError          string            `json:"last_error,omitempty"`
+}
+
+// Target states reported by Status.
+const (
+	statusUp      = "up"
+	statusDown    = "down"
+	statusUnknown = "unknown"
+	statusPending = "pending"
+)
+
+// Status returns the state of every discovered and pending target, sorted
+// by URI. Targets are unknown until their first scrape, and pending while
+// their discovery is being retried.
+func (m *targetManager) Status() []targetStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	statuses := make([]targetStatus, 0, len(m.targets)+len(m.pending))
+	for _, t := range m.targets {
+		s := targetStatus{
+			URI:     t.config.URI,
+			Name:    t.config.Name,
+			Labels:  t.config.Labels,
+			Beat:    t.info.Beat,
+			Version: t.info.Version,
+			Status:  statusUnknown,
+		}
+		if r, ok := t.collector.(collector.StatusReporter); ok {
+			if last := r.LastScrape(); !last.Time.IsZero() {
+				s.LastScrape = &last.Time
+				s.LastScrapeDuration = last.Duration.Seconds()
+				s.Status = statusUp
+				if last.Err != nil {
+					s.Status = statusDown
+					s.LastError = last.Err.Error()
+				}
+			}
+		}
+		statuses = append(statuses, s)
+	}
+	for beatURI, p := range m.pending {
+		// Changed targets keep their previous collector while being retried.
+		if _, ok := m.targets[beatURI]; ok {
+			continue
+		}
+		s := targetStatus{
+			URI:    p.config.URI,
+			Name:   p.config.Name,
+			Labels: p.config.Labels,
+			Status: statusPending,
+		}
+		if p.err != nil {
+			s.LastError = p.err.Error()
+		}
+		statuses = append(statuses, s)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].URI < statuses[j].URI })
+	return statuses
+}
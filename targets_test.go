@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/trustpilot/beat-exporter/internal/config"
+)
+
+// seriesKeys returns the name and labels of every series, sorted.
+func seriesKeys(families []*dto.MetricFamily) []string {
+	var keys []string
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := make([]string, 0, len(metric.GetLabel()))
+			for _, label := range metric.GetLabel() {
+				labels = append(labels, label.GetName()+"="+label.GetValue())
+			}
+			sort.Strings(labels)
+			keys = append(keys, family.GetName()+"{"+strings.Join(labels, ",")+"}")
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestSyncSameTypeTargets(t *testing.T) {
+	const beats = 3
+	var uris []string
+	for i := 0; i < beats; i++ {
+		server := httptest.NewServer(fakeBeat(t, "filebeat"))
+		defer server.Close()
+		uris = append(uris, server.URL)
+	}
+
+	tests := []struct {
+		name   string
+		config func(i int) config.TargetConfig
+	}{
+		{
+			name:   "unnamed",
+			config: func(i int) config.TargetConfig { return config.TargetConfig{URI: uris[i]} },
+		},
+		{
+			name: "named",
+			config: func(i int) config.TargetConfig {
+				return config.TargetConfig{URI: uris[i], Name: "filebeat-" + string(rune('a'+i))}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var configs []config.TargetConfig
+			for i := range uris {
+				configs = append(configs, test.config(i))
+			}
+			targets := newTargetManager(prometheus.NewRegistry(), scrapeOptions{}, 0, 0, 0, 0)
+			if failed := targets.Sync(configs); len(failed) > 0 {
+				t.Fatalf("failed to discover %v", failed)
+			}
+			defer func() {
+				for _, target := range targets.targets {
+					target.close()
+				}
+			}()
+
+			// Without a deadline the registries of the targets are gathered,
+			// with one the collectors are registered again for the scrape.
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			for _, ctx := range []context.Context{context.Background(), ctx} {
+				families, err := targets.GatherContext(ctx)
+				if err != nil {
+					t.Fatalf("gather failed: %v", err)
+				}
+				keys := seriesKeys(families)
+				for i := 1; i < len(keys); i++ {
+					if keys[i] == keys[i-1] {
+						t.Errorf("duplicate series %s", keys[i])
+					}
+				}
+				if up := gaugeValues(families, "filebeat_up"); len(up) != beats {
+					t.Errorf("filebeat_up = %v, want a series for each of %d targets", up, beats)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncDiscoversWithoutLock(t *testing.T) {
+	const beats = 2
+	started := make(chan struct{}, beats)
+	release := make(chan struct{})
+	var uris []string
+	for i := 0; i < beats; i++ {
+		beat := fakeBeat(t, "filebeat")
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/" {
+				started <- struct{}{}
+				<-release
+			}
+			beat.ServeHTTP(w, r)
+		}))
+		defer server.Close()
+		uris = append(uris, server.URL)
+	}
+
+	targets := newTargetManager(prometheus.NewRegistry(), scrapeOptions{}, 0, 0, 0, 0)
+	done := make(chan []string)
+	go func() {
+		done <- targets.Sync([]config.TargetConfig{{URI: uris[0]}, {URI: uris[1]}})
+	}()
+	defer func() {
+		for _, target := range targets.targets {
+			target.close()
+		}
+	}()
+
+	// Both Beats are asked for their info before either answers.
+	timeout := time.After(10 * time.Second)
+	for i := 0; i < beats; i++ {
+		select {
+		case <-started:
+		case <-timeout:
+			close(release)
+			t.Fatalf("%d of %d Beats queried at once", i, beats)
+		}
+	}
+
+	// A writer such as the retry loop isn't held up by the discovery.
+	locked := make(chan struct{})
+	go func() {
+		targets.mu.Lock()
+		targets.mu.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-timeout:
+		t.Error("target list locked during discovery")
+	}
+
+	close(release)
+	if failed := <-done; len(failed) > 0 {
+		t.Fatalf("failed to discover %v", failed)
+	}
+	if n := targets.Discovered(); n != beats {
+		t.Errorf("discovered %d targets, want %d", n, beats)
+	}
+}
+
+func TestSyncKeepsRetryBackoff(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+		http.Error(w, "starting", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return attempts
+	}
+
+	targets := newTargetManager(prometheus.NewRegistry(), scrapeOptions{}, time.Minute, 10*time.Minute, 0, 0)
+	tc := config.TargetConfig{URI: server.URL}
+	for i := 0; i < 3; i++ {
+		if failed := targets.Sync([]config.TargetConfig{tc}); len(failed) != 1 {
+			t.Fatalf("sync %d: failed = %v, want the target", i, failed)
+		}
+	}
+	if n := count(); n != 1 {
+		t.Errorf("discovery attempted %d times, want once until the backoff expires", n)
+	}
+	if backoff := targets.pending[tc.URI].backoff; backoff != time.Minute {
+		t.Errorf("backoff = %s, want %s", backoff, time.Minute)
+	}
+
+	// A changed target is discovered right away, keeping the backoff growing.
+	tc.Name = "filebeat"
+	targets.Sync([]config.TargetConfig{tc})
+	if n := count(); n != 2 {
+		t.Errorf("discovery attempted %d times, want 2 after the change", n)
+	}
+	if backoff := targets.pending[tc.URI].backoff; backoff != 2*time.Minute {
+		t.Errorf("backoff = %s, want %s", backoff, 2*time.Minute)
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/exporter-toolkit/web"
+	log "github.com/sirupsen/logrus"
+)
+
+// webConfig holds the settings of the listener serving the exporter.
+type webConfig struct {
+	listenAddress   string
+	tlsCertFile     string
+	tlsKeyFile      string
+	tlsMinVersion   string
+	tlsCipherSuites string
+	tlsClientCA     string
+	allowedCIDRs    string
+	socketMode      os.FileMode
+
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+
+	landingTemplate string
+
+	// configFile is an exporter-toolkit web configuration file, defining TLS,
+	// client certificate and basic authentication settings.
+	configFile string
+}
+
+// validate checks the listener settings and loads the files they refer to.
+func (c *webConfig) validate() error {
+	if (c.tlsCertFile == "") != (c.tlsKeyFile == "") {
+		return fmt.Errorf("both --tls.certfile and --tls.keyfile must be set to enable TLS")
+	}
+	if c.tlsCertFile != "" && c.configFile != "" {
+		return fmt.Errorf("--tls.certfile and --tls.keyfile can't be used together with --web.config.file")
+	}
+	if c.tlsCipherSuites != "" && c.configFile != "" {
+		return fmt.Errorf("--tls.cipher-suites can't be used together with --web.config.file, set cipher_suites in the file instead")
+	}
+	if c.tlsClientCA != "" && c.configFile != "" {
+		return fmt.Errorf("--tls.client-ca can't be used together with --web.config.file, set client_ca_file in the file instead")
+	}
+	if c.tlsClientCA != "" && c.tlsCertFile == "" {
+		return fmt.Errorf("--tls.client-ca requires --tls.certfile and --tls.keyfile")
+	}
+	if c.tlsCertFile != "" {
+		if _, err := tls.LoadX509KeyPair(c.tlsCertFile, c.tlsKeyFile); err != nil {
+			return fmt.Errorf("failed to load TLS key pair: %w", err)
+		}
+	}
+	if _, err := c.tlsConfig(); err != nil {
+		return err
+	}
+	if networks, err := c.allowedNetworks(); err != nil {
+		return err
+	} else if len(networks) > 0 && c.socketPath() != "" {
+		return fmt.Errorf("--web.allowed-cidrs can't be used with a Unix socket listen address")
+	}
+	if _, err := loadIndexTemplate(c.landingTemplate); err != nil {
+		return err
+	}
+	if err := web.Validate(c.configFile); err != nil {
+		return fmt.Errorf("invalid web config file: %w", err)
+	}
+	return nil
+}
+
+// tlsVersions maps the names accepted by --tls.min-version to TLS versions.
+var tlsVersions = map[string]uint16{
+	"TLS10": tls.VersionTLS10,
+	"TLS11": tls.VersionTLS11,
+	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+// tlsConfig returns the TLS settings of the --tls.certfile listener, without
+// its certificate.
+func (c *webConfig) tlsConfig() (*tls.Config, error) {
+	minVersion, ok := tlsVersions[c.tlsMinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unknown TLS version %q, expected one of TLS10, TLS11, TLS12, TLS13", c.tlsMinVersion)
+	}
+	cfg := &tls.Config{MinVersion: minVersion}
+
+	if c.tlsCipherSuites != "" {
+		ids := make(map[string]uint16)
+		for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			ids[suite.Name] = suite.ID
+		}
+		for _, name := range strings.Split(c.tlsCipherSuites, ",") {
+			id, ok := ids[strings.TrimSpace(name)]
+			if !ok {
+				return nil, fmt.Errorf("unknown TLS cipher suite %q", name)
+			}
+			cfg.CipherSuites = append(cfg.CipherSuites, id)
+		}
+	}
+
+	// With a client CA, every client must present a certificate signed by it.
+	if c.tlsClientCA != "" {
+		caCert, err := ioutil.ReadFile(c.tlsClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", c.tlsClientCA)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// allowedNetworks parses --web.allowed-cidrs. Plain IP addresses are
+// accepted as single-address networks. An empty list allows every client.
+func (c *webConfig) allowedNetworks() ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, s := range strings.Split(c.allowedCIDRs, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if ip := net.ParseIP(s); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q in --web.allowed-cidrs", s)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// allowNetworks rejects requests whose source address is outside of the given
+// networks with 403. Forwarding headers are not trusted.
+func allowNetworks(networks []*net.IPNet, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			for _, network := range networks {
+				if network.Contains(ip) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		log.Debugf("Rejected request from %s outside of --web.allowed-cidrs", r.RemoteAddr)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	})
+}
+
+// statusRecorder records the status code written to a ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logAccess logs every request served by next with its method, path, status,
+// duration and remote address.
+func logAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		log.WithFields(log.Fields{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      recorder.status,
+			"duration":    time.Since(start).Seconds(),
+			"remote_addr": r.RemoteAddr,
+		}).Info("HTTP request")
+	})
+}
+
+// gzipResponseWriter compresses the response body, starting the gzip
+// stream once the header is written, so that error responses written with
+// http.Error are compressed and labelled as such too.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	level       int
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		// Responses without a body must stay empty, not hold an empty gzip
+		// stream.
+		if status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified {
+			if gz, err := gzip.NewWriterLevel(w.ResponseWriter, w.level); err == nil {
+				w.Header().Del("Content-Length")
+				w.Header().Set("Content-Encoding", "gzip")
+				w.gz = gz
+			} else {
+				log.Errorf("Failed to compress response: %v", err)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+// Flush implements http.Flusher, flushing the data compressed so far.
+func (w *gzipResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *gzipResponseWriter) close() {
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
+
+// gzipHandler compresses responses to clients accepting gzip at the given
+// level, in place of the compression of the metrics handlers. With
+// gzip.NoCompression responses are never compressed.
+func gzipHandler(level int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Keep the handlers from compressing the response themselves.
+		r.Header.Del("Accept-Encoding")
+		if level == gzip.NoCompression {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		gw := &gzipResponseWriter{ResponseWriter: w, level: level}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// startHTTPServer starts the HTTP server for Prometheus metrics. Only the
+// handlers of the given mux are served, never those registered on
+// http.DefaultServeMux by imported packages.
+func startHTTPServer(cfg webConfig, certs *certReloader, handler http.Handler) {
+	log.Infof("Starting exporter at %s", cfg.listenAddress)
+	listener, err := cfg.listen()
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.readHeaderTimeout,
+		WriteTimeout:      cfg.writeTimeout,
+		IdleTimeout:       cfg.idleTimeout,
+		MaxHeaderBytes:    cfg.maxHeaderBytes,
+	}
+	switch {
+	case cfg.configFile != "":
+		if err := web.Serve(listener, server, cfg.configFile, kitLogger{}); err != nil {
+			log.Fatalf("HTTP server error: %v", err)
+		}
+	case certs != nil:
+		tlsConfig, err := cfg.tlsConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+		tlsConfig.GetCertificate = certs.GetCertificate
+		server.TLSConfig = tlsConfig
+		if err := server.ServeTLS(listener, "", ""); err != nil {
+			log.Fatalf("TLS server error: %v", err)
+		}
+	default:
+		if err := server.Serve(listener); err != nil {
+			log.Fatalf("HTTP server error: %v", err)
+		}
+	}
+}
+
+// socketPath returns the path of the Unix socket to listen on, or "" if the
+// listen address is a TCP address.
+func (c *webConfig) socketPath() string {
+	if strings.HasPrefix(c.listenAddress, "unix://") {
+		return strings.TrimPrefix(c.listenAddress, "unix://")
+	}
+	return ""
+}
+
+// listen opens the listener of the exporter. A socket left over by a
+// previous run at the Unix socket path is removed first.
+func (c *webConfig) listen() (net.Listener, error) {
+	path := c.socketPath()
+	if path == "" {
+		return net.Listen("tcp", c.listenAddress)
+	}
+
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, c.socketMode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	return listener, nil
+}
+
+// certReloader serves the key pair of --tls.certfile and --tls.keyfile and
+// reloads it when the files change, so that rotated certificates are picked
+// up without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the key pair from disk.
+func (r *certReloader) Reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+
+	r.mu.Lock()
+	r.cert, r.modTime = &cert, modTime
+	r.mu.Unlock()
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate. The key pair is
+// reloaded first if one of the files changed; if that fails, the current
+// certificate keeps being served.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	cert, loaded := r.cert, r.modTime
+	r.mu.RUnlock()
+
+	if modTime, err := r.latestModTime(); err == nil && modTime.After(loaded) {
+		if err := r.Reload(); err != nil {
+			log.Errorf("Failed to reload TLS certificate, keeping the current one: %v", err)
+		} else {
+			log.Info("Reloaded TLS certificate")
+			r.mu.RLock()
+			cert = r.cert
+			r.mu.RUnlock()
+		}
+	}
+	return cert, nil
+}
+
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
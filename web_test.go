@@ -0,0 +1,99 @@
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGzipHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		status   int
+		encoding string
+		body     string
+	}{
+		{
+			name:     "body",
+			handler:  func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("metrics\n")) },
+			status:   http.StatusOK,
+			encoding: "gzip",
+			body:     "metrics\n",
+		},
+		{
+			name: "error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "no target", http.StatusServiceUnavailable)
+			},
+			status:   http.StatusServiceUnavailable,
+			encoding: "gzip",
+			body:     "no target\n",
+		},
+		{
+			name:    "no content",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) },
+			status:  http.StatusNoContent,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			rec := httptest.NewRecorder()
+			gzipHandler(gzip.BestSpeed, test.handler).ServeHTTP(rec, req)
+
+			// The headers as sent, not as changed after WriteHeader.
+			res := rec.Result()
+			if res.StatusCode != test.status {
+				t.Errorf("status = %d, want %d", res.StatusCode, test.status)
+			}
+			if got := res.Header.Get("Content-Encoding"); got != test.encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, test.encoding)
+			}
+			if got := res.Header.Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			if test.encoding == "" {
+				if rec.Body.Len() != 0 {
+					t.Errorf("body = %q, want none", rec.Body.String())
+				}
+				return
+			}
+			gz, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatalf("body isn't gzipped: %v", err)
+			}
+			body, err := ioutil.ReadAll(gz)
+			if err != nil {
+				t.Fatalf("failed to decompress body: %v", err)
+			}
+			if string(body) != test.body {
+				t.Errorf("body = %q, want %q", body, test.body)
+			}
+		})
+	}
+}
+
+func TestGzipHandlerFlush(t *testing.T) {
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	gzipHandler(gzip.BestSpeed, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("response writer isn't a http.Flusher")
+		}
+		w.Write([]byte("partial"))
+		flusher.Flush()
+		if !rec.Flushed {
+			t.Error("response wasn't flushed")
+		}
+	})).ServeHTTP(rec, req)
+
+	if got := rec.Result().Header.Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Content-Encoding = %q, want gzip", got)
+	}
+}